@@ -0,0 +1,38 @@
+package bloomfilter
+
+import "github.com/goal-web/contracts"
+
+// AddMany adds all the items, in a single call when the filter implements BatchFilter.
+func AddMany(filter contracts.BloomFilter, items [][]byte) {
+	if batch, ok := filter.(BatchFilter); ok {
+		batch.AddMany(items)
+		return
+	}
+	for _, item := range items {
+		filter.Add(item)
+	}
+}
+
+// TestMany tests all the items, in a single call when the filter implements BatchFilter.
+func TestMany(filter contracts.BloomFilter, items [][]byte) []bool {
+	if batch, ok := filter.(BatchFilter); ok {
+		return batch.TestMany(items)
+	}
+	results := make([]bool, len(items))
+	for i, item := range items {
+		results[i] = filter.Test(item)
+	}
+	return results
+}
+
+// TestOrAddMany calls TestOrAdd for all the items, in a single call when the filter implements BatchFilter.
+func TestOrAddMany(filter contracts.BloomFilter, items [][]byte) []bool {
+	if batch, ok := filter.(BatchFilter); ok {
+		return batch.TestOrAddMany(items)
+	}
+	results := make([]bool, len(items))
+	for i, item := range items {
+		results[i] = filter.TestOrAdd(item)
+	}
+	return results
+}
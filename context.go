@@ -0,0 +1,31 @@
+package bloomfilter
+
+import (
+	"context"
+	"github.com/goal-web/contracts"
+)
+
+// AddCtx adds the byte array with the filter's AddCtx when it implements ContextFilter,
+// the other filters do not wait on a remote storage so ctx is only checked before the call.
+func AddCtx(ctx context.Context, filter contracts.BloomFilter, bytes []byte) error {
+	if contextFilter, ok := filter.(ContextFilter); ok {
+		return contextFilter.AddCtx(ctx, bytes)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	filter.Add(bytes)
+	return nil
+}
+
+// TestCtx tests the byte array with the filter's TestCtx when it implements ContextFilter,
+// the other filters do not wait on a remote storage so ctx is only checked before the call.
+func TestCtx(ctx context.Context, filter contracts.BloomFilter, bytes []byte) (bool, error) {
+	if contextFilter, ok := filter.(ContextFilter); ok {
+		return contextFilter.TestCtx(ctx, bytes)
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return filter.Test(bytes), nil
+}
@@ -0,0 +1,100 @@
+package bloomfilter
+
+import (
+	"context"
+	"github.com/goal-web/contracts"
+	"time"
+)
+
+// RemovableFilter is a bloom filter that supports removing items, such as the counting and cuckoo filters.
+type RemovableFilter interface {
+	contracts.BloomFilter
+
+	// Remove removes the byte array from the filter.
+	Remove(bytes []byte)
+	// RemoveString removes the string from the filter.
+	RemoveString(str string)
+}
+
+// BatchFilter is a bloom filter that handles many items per call, all the drivers implement it.
+type BatchFilter interface {
+	contracts.BloomFilter
+
+	// AddMany adds all the items.
+	AddMany(items [][]byte)
+	// TestMany tests all the items, the results are in the order of the items.
+	TestMany(items [][]byte) []bool
+	// TestOrAddMany is the equivalent to calling TestOrAdd for every item, in order.
+	TestOrAddMany(items [][]byte) []bool
+}
+
+// PersistentFilter is a bloom filter stored in a file whose Load and Save return errors.
+// LoadE returns nil when the file does not exist yet and an error wrapping drivers.CorruptFileErr
+// when it can not be decoded.
+type PersistentFilter interface {
+	contracts.BloomFilter
+
+	LoadE() error
+	SaveE() error
+}
+
+// ContextFilter is a bloom filter whose calls honor the cancellation and the deadline of a context and return
+// the errors of the storage, instead of logging them and answering not present. The redis, counting, redisbloom
+// and window drivers stored in redis implement it, see AddCtx and TestCtx for the other filters.
+type ContextFilter interface {
+	contracts.BloomFilter
+
+	// AddCtx adds the byte array to the filter.
+	AddCtx(ctx context.Context, bytes []byte) error
+	// TestCtx tests whether the byte array may be in the filter.
+	TestCtx(ctx context.Context, bytes []byte) (bool, error)
+}
+
+// DirtyFilter is a persistent filter that reports its writes, the file and mmap drivers implement it
+// so that the factory saves them after the number of writes set by the "autosave_writes" field.
+type DirtyFilter interface {
+	PersistentFilter
+
+	// NotifyWrites sends to ch, without blocking, once n writes changed the filter since it was last saved.
+	NotifyWrites(n uint64, ch chan<- struct{})
+}
+
+// ExpiringFilter is a bloom filter whose storage expires, the redis driver implements it
+// and sets the time to live configured by the "expire" and "sliding" fields on writes.
+type ExpiringFilter interface {
+	contracts.BloomFilter
+
+	// ExpireAt sets the time the filter is deleted at.
+	ExpireAt(tm time.Time) error
+	// TTL returns the remaining time to live of the filter, it is negative when the filter does not expire.
+	TTL() (time.Duration, error)
+}
+
+// MergeableFilter is a bloom filter that can be combined with compatible filters of the same driver,
+// filters are compatible when they have the same number of bits, hash functions and hash function.
+// The memory, file and redis drivers implement it, errors wrap drivers.IncompatibleFilterErr.
+type MergeableFilter interface {
+	contracts.BloomFilter
+
+	// Union adds the items of other to the filter.
+	Union(other contracts.BloomFilter) error
+	// Intersect keeps only the items that are in other too.
+	Intersect(other contracts.BloomFilter) error
+	// Merge is the equivalent to calling Union for every filter.
+	Merge(others ...contracts.BloomFilter) error
+}
+
+// StatsFilter reports how full a filter is, all the drivers implement it.
+type StatsFilter interface {
+	contracts.BloomFilter
+
+	// EstimatedItems returns the approximate number of distinct items in the filter,
+	// bloom filters estimate it from Count and Size with the Swamidass–Baldi formula.
+	EstimatedItems() uint
+	// CurrentFPR returns the false positive probability from the actual fill ratio.
+	CurrentFPR() float64
+	// Capacity returns the number of items the filter is sized for.
+	Capacity() uint
+	// TargetFPR returns the configured false positive probability.
+	TargetFPR() float64
+}
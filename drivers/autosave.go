@@ -0,0 +1,322 @@
+package drivers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/supports/utils"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// pagesJournalMagic starts the journal of the pages written in place by File.flush.
+var pagesJournalMagic = [4]byte{'G', 'W', 'P', 'J'}
+
+// dirtyPageWords is the number of words of a page tracked by dirtyPages, 4KB.
+const dirtyPageWords = 512
+
+// ParseAutosave returns the "autosave" field of config, the interval the factory saves the filter at,
+// and the "autosave_writes" field, the number of writes after which it is saved. Zero disables either.
+func ParseAutosave(name string, config contracts.Fields) (time.Duration, uint64, error) {
+	interval, err := durationField(name, config, "autosave", 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	if interval < 0 {
+		return 0, 0, &ConfigError{Filter: name, Field: "autosave", Err: fmt.Errorf("%w: %s", InvalidFieldErr, interval)}
+	}
+	writes := utils.GetInt64Field(config, "autosave_writes", 0)
+	if writes < 0 {
+		return 0, 0, &ConfigError{Filter: name, Field: "autosave_writes", Err: fmt.Errorf("%w: %d", InvalidFieldErr, writes)}
+	}
+	return interval, uint64(writes), nil
+}
+
+// writeNotifier signals a channel once n writes changed a filter since it was last saved.
+type writeNotifier struct {
+	n      uint64
+	ch     chan<- struct{}
+	writes atomic.Uint64
+}
+
+// wrote counts a write, the channel is signaled without blocking.
+func (this *writeNotifier) wrote() {
+	if this.writes.Add(1) >= this.n {
+		select {
+		case this.ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// dirtyPages tracks the pages of a bitset that changed since they were last written to the file.
+type dirtyPages struct {
+	// pages holds a bit per page.
+	pages    []uint64
+	notifier atomic.Pointer[writeNotifier]
+}
+
+// newDirtyPages tracks a bitset of words, the pages start dirty so that the first save writes them all.
+func newDirtyPages(words int) *dirtyPages {
+	dirty := &dirtyPages{}
+	dirty.resize(words)
+	return dirty
+}
+
+// mark marks the page holding the ith bit of the bitset.
+func (this *dirtyPages) mark(i uint) {
+	setBit(this.pages, i/64/dirtyPageWords)
+}
+
+// resize tracks a bitset of words whose pages are all dirty, the caller must hold the exclusive lock.
+func (this *dirtyPages) resize(words int) {
+	pages := (words + dirtyPageWords - 1) / dirtyPageWords
+	this.pages = make([]uint64, (pages+63)/64)
+	this.markAll()
+}
+
+// markAll marks every page, the caller must hold the lock.
+func (this *dirtyPages) markAll() {
+	for i := range this.pages {
+		atomic.StoreUint64(&this.pages[i], ^uint64(0))
+	}
+}
+
+// take returns the indexes of the dirty pages below pages and clears every page, the caller must hold the exclusive lock.
+func (this *dirtyPages) take(pages int) []int {
+	dirty := make([]int, 0)
+	for i := range this.pages {
+		word := atomic.SwapUint64(&this.pages[i], 0)
+		for bit := 0; word != 0 && bit < 64; bit++ {
+			if word&(1<<bit) != 0 && 64*i+bit < pages {
+				dirty = append(dirty, 64*i+bit)
+			}
+		}
+	}
+	return dirty
+}
+
+// wrote counts a write that changed the filter.
+func (this *dirtyPages) wrote() {
+	if notifier := this.notifier.Load(); notifier != nil {
+		notifier.wrote()
+	}
+}
+
+// saved restarts the count of writes.
+func (this *dirtyPages) saved() {
+	if notifier := this.notifier.Load(); notifier != nil {
+		notifier.writes.Store(0)
+	}
+}
+
+// NotifyWrites sends to ch, without blocking, once n writes changed the filter since it was last saved.
+func (this *File) NotifyWrites(n uint64, ch chan<- struct{}) {
+	this.dirty.notifier.Store(&writeNotifier{n: n, ch: ch})
+}
+
+// NotifyWrites sends to ch, without blocking, once n writes changed the filter since it was last saved.
+func (this *Mmap) NotifyWrites(n uint64, ch chan<- struct{}) {
+	this.notifier.Store(&writeNotifier{n: n, ch: ch})
+}
+
+// fileLayout returns the size of the file written by WriteTo for a header and a bitset of words,
+// and the offset of the first word.
+func fileLayout(words int) (size int64, offset int64) {
+	offset = int64(len(formatMagic) + binary.Size(header{}) + binary.Size(uint64(0)))
+	return offset + int64(8*words) + int64(binary.Size(uint32(0))), offset
+}
+
+// flush writes the pages changed since the last save in place. The pages, the header and the checksum are first
+// written to the journal path.pages and synced, then written in place and the journal is removed: a crash leaves
+// either a torn journal and an unchanged file, or a complete journal that replayPages writes again.
+// It returns false when the file does not exist or has not the layout of the filter, which must then be written in full.
+func (this *File) flush() (bool, error) {
+	file, err := os.OpenFile(this.filepath, os.O_RDWR, 0)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+	current := make([]byte, len(formatMagic)+binary.Size(header{}))
+	if _, err = file.ReadAt(current, 0); err != nil || !bytes.Equal(current[:len(formatMagic)], formatMagic[:]) {
+		return false, nil
+	}
+	var onDisk header
+	_ = binary.Read(bytes.NewReader(current[len(formatMagic):]), binary.BigEndian, &onDisk)
+
+	writes, ok := this.snapshotPages(info.Size(), onDisk)
+	if !ok {
+		return false, nil
+	}
+	err = writePagesJournal(this.filepath+".pages", writes)
+	if err == nil {
+		err = applyPages(file, writes)
+	}
+	if err == nil {
+		err = os.Remove(this.filepath + ".pages")
+	}
+	if err != nil {
+		// the pages may be partially written, they are all written again by the next save.
+		this.mutex.RLock()
+		this.markDirty()
+		this.mutex.RUnlock()
+	}
+	return true, err
+}
+
+// pageWrite is a write of File.flush, data is written at offset.
+type pageWrite struct {
+	offset int64
+	data   []byte
+}
+
+// snapshotPages copies the dirty pages, the header and the checksum under the exclusive lock, so that they agree.
+// ok is false when a file of size whose header is onDisk does not have the layout of the filter.
+func (this *File) snapshotPages(size int64, onDisk header) (writes []pageWrite, ok bool) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	h := this.header()
+	h.Version = formatVersion
+	words := this.bits.Bytes()
+	expected, offset := fileLayout(len(words))
+	onDisk.Flags, onDisk.Count = h.Flags, h.Count
+	if size != expected || onDisk != h {
+		return nil, false
+	}
+
+	for _, page := range this.dirty.take((len(words) + dirtyPageWords - 1) / dirtyPageWords) {
+		start := page * dirtyPageWords
+		end := start + dirtyPageWords
+		if end > len(words) {
+			end = len(words)
+		}
+		buffer := make([]byte, 0, 8*(end-start))
+		for _, word := range words[start:end] {
+			buffer = binary.BigEndian.AppendUint64(buffer, word)
+		}
+		writes = append(writes, pageWrite{offset: offset + int64(8*start), data: buffer})
+	}
+	var encoded bytes.Buffer
+	_ = binary.Write(&encoded, binary.BigEndian, h)
+	writes = append(writes, pageWrite{offset: int64(len(formatMagic)), data: encoded.Bytes()})
+
+	// the checksum covers the whole file, it is computed a page at a time to avoid copying the bitset.
+	checksum := crc32.New(crc32c)
+	checksum.Write(formatMagic[:])
+	checksum.Write(encoded.Bytes())
+	buffer := binary.BigEndian.AppendUint64(make([]byte, 0, 8*dirtyPageWords), uint64(this.bits.Len()))
+	for _, word := range words {
+		if len(buffer) == cap(buffer) {
+			checksum.Write(buffer)
+			buffer = buffer[:0]
+		}
+		buffer = binary.BigEndian.AppendUint64(buffer, word)
+	}
+	checksum.Write(buffer)
+	sum := binary.BigEndian.AppendUint32(nil, checksum.Sum32())
+	return append(writes, pageWrite{offset: size - int64(len(sum)), data: sum}), true
+}
+
+// applyPages writes the pages at their offsets and syncs the file.
+func applyPages(file *os.File, writes []pageWrite) error {
+	for _, write := range writes {
+		if _, err := file.WriteAt(write.data, write.offset); err != nil {
+			return err
+		}
+	}
+	return file.Sync()
+}
+
+// writePagesJournal writes the journal of writes to path: the magic number, the number of writes,
+// the offset, length and data of every write and a CRC32C of all of them.
+func writePagesJournal(path string, writes []pageWrite) error {
+	journal := append([]byte{}, pagesJournalMagic[:]...)
+	journal = binary.BigEndian.AppendUint32(journal, uint32(len(writes)))
+	for _, write := range writes {
+		journal = binary.BigEndian.AppendUint64(journal, uint64(write.offset))
+		journal = binary.BigEndian.AppendUint32(journal, uint32(len(write.data)))
+		journal = append(journal, write.data...)
+	}
+	journal = binary.BigEndian.AppendUint32(journal, crc32.Checksum(journal, crc32c))
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(journal)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		syncDir(path)
+	}
+	return err
+}
+
+// readPagesJournal decodes a journal written by writePagesJournal, ok is false when it is torn.
+func readPagesJournal(journal []byte) (writes []pageWrite, ok bool) {
+	if len(journal) < len(pagesJournalMagic)+8 || !bytes.Equal(journal[:len(pagesJournalMagic)], pagesJournalMagic[:]) {
+		return nil, false
+	}
+	end := len(journal) - 4
+	if crc32.Checksum(journal[:end], crc32c) != binary.BigEndian.Uint32(journal[end:]) {
+		return nil, false
+	}
+	count := binary.BigEndian.Uint32(journal[len(pagesJournalMagic):])
+	offset := len(pagesJournalMagic) + 4
+	for i := uint32(0); i < count; i++ {
+		if end-offset < 12 {
+			return nil, false
+		}
+		at, length := binary.BigEndian.Uint64(journal[offset:]), binary.BigEndian.Uint32(journal[offset+8:])
+		offset += 12
+		if uint64(end-offset) < uint64(length) {
+			return nil, false
+		}
+		writes = append(writes, pageWrite{offset: int64(at), data: journal[offset : offset+int(length)]})
+		offset += int(length)
+	}
+	return writes, offset == end
+}
+
+// replayPages writes again the pages of the journal left by a flush interrupted by a crash. A torn journal
+// was written before the file was changed, it is removed.
+func replayPages(path string) error {
+	journal, err := os.ReadFile(path + ".pages")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if writes, ok := readPagesJournal(journal); ok {
+		file, err := os.OpenFile(path, os.O_RDWR, 0)
+		if err != nil {
+			return err
+		}
+		err = applyPages(file, writes)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return os.Remove(path + ".pages")
+}
@@ -0,0 +1,144 @@
+package drivers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/supports/utils"
+	"sync"
+	"time"
+)
+
+var CircuitOpenErr = errors.New("circuit breaker is open")
+
+// policies of the "on_error" field, the answer of Test when redis fails.
+const (
+	// OnErrorAllow answers not present, callers proceed as for a new item.
+	OnErrorAllow = "allow"
+	// OnErrorDeny answers present.
+	OnErrorDeny = "deny"
+	// OnErrorFallback answers from a local filter holding the adds of the process, see redisFallback.
+	OnErrorFallback = "fallback"
+)
+
+// redisFallbackItems is the largest default capacity of the local filter of the fallback policy,
+// it takes about 1.2MB at a 1% false positive rate.
+const redisFallbackItems uint = 1 << 20
+
+// redisFallback returns the capacity and the false positive rate of the local filter of the fallback policy.
+// It is sized by the "fallback_items" and "fallback_fpr" fields, the items of the filter up to redisFallbackItems
+// and its false positive rate by default, not by its number of bits: the local filter takes items*1.44*log2(1/fpr)
+// bits of memory and records every add, including while redis is healthy.
+func redisFallback(name string, config contracts.Fields, params Params) (uint, float64, error) {
+	items, fpr := params.Items, params.FPR
+	if items > redisFallbackItems {
+		items = redisFallbackItems
+	}
+	if _, exists := config["fallback_items"]; exists {
+		value := utils.GetInt64Field(config, "fallback_items")
+		if value <= 0 {
+			return 0, 0, &ConfigError{Filter: name, Field: "fallback_items", Err: fmt.Errorf("%w: %d, must be greater than 0", InvalidFieldErr, value)}
+		}
+		items = uint(value)
+	}
+	if _, exists := config["fallback_fpr"]; exists {
+		fpr = utils.GetFloat64Field(config, "fallback_fpr")
+		if !(fpr > 0 && fpr < 1) {
+			return 0, 0, &ConfigError{Filter: name, Field: "fallback_fpr", Err: fmt.Errorf("%w: %v, must be between 0 and 1", InvalidFieldErr, fpr)}
+		}
+	}
+	return items, fpr, nil
+}
+
+// redisOnError returns the "on_error" field of config, allow by default, and the circuit breaker configured
+// by "breaker_threshold" (5 consecutive failures by default, 0 disables it) and "breaker_cooldown" (10s by default).
+func redisOnError(name string, config contracts.Fields) (string, *Breaker, error) {
+	onError := utils.GetStringField(config, "on_error", OnErrorAllow)
+	switch onError {
+	case OnErrorAllow, OnErrorDeny, OnErrorFallback:
+	default:
+		return "", nil, &ConfigError{Filter: name, Field: "on_error", Err: fmt.Errorf("%w: %s", InvalidFieldErr, onError)}
+	}
+	threshold := utils.GetInt64Field(config, "breaker_threshold", 5)
+	if threshold < 0 {
+		return "", nil, &ConfigError{Filter: name, Field: "breaker_threshold", Err: fmt.Errorf("%w: %d", InvalidFieldErr, threshold)}
+	}
+	cooldown, err := durationField(name, config, "breaker_cooldown", 10*time.Second)
+	if err != nil {
+		return "", nil, err
+	}
+	if cooldown <= 0 {
+		return "", nil, &ConfigError{Filter: name, Field: "breaker_cooldown", Err: fmt.Errorf("%w: %s", InvalidFieldErr, cooldown)}
+	}
+	if threshold == 0 {
+		return onError, nil, nil
+	}
+	return onError, &Breaker{Threshold: uint(threshold), Cooldown: cooldown}, nil
+}
+
+// Breaker is a circuit breaker: after Threshold consecutive failures it opens and the calls fail with
+// CircuitOpenErr without waiting on the server. Once Cooldown has passed a single call probes the server,
+// the breaker closes when it succeeds and opens for another Cooldown when it fails.
+// A nil Breaker lets every call through. It is safe for concurrent use.
+type Breaker struct {
+	Threshold uint
+	Cooldown  time.Duration
+
+	mutex    sync.Mutex
+	failures uint
+	openedAt time.Time
+	probing  bool
+}
+
+// allow returns whether a call may run, and whether it is the probe of an open breaker.
+func (this *Breaker) allow() (allowed bool, probe bool) {
+	if this == nil {
+		return true, false
+	}
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.failures < this.Threshold {
+		return true, false
+	}
+	if this.probing || time.Since(this.openedAt) < this.Cooldown {
+		return false, false
+	}
+	this.probing = true
+	return true, true
+}
+
+// done records the result of a call, it returns whether the breaker opened. Calls canceled by the caller do not count.
+func (this *Breaker) done(probe bool, err error) (opened bool) {
+	if this == nil {
+		return false
+	}
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if probe {
+		this.probing = false
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if err == nil {
+		this.failures = 0
+		return false
+	}
+	this.failures++
+	if this.failures == this.Threshold || probe {
+		this.openedAt = time.Now()
+		return true
+	}
+	return false
+}
+
+// Open returns whether calls are failing with CircuitOpenErr.
+func (this *Breaker) Open() bool {
+	if this == nil {
+		return false
+	}
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.failures >= this.Threshold
+}
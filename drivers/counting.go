@@ -0,0 +1,396 @@
+package drivers
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/goal-web/bloomfilter/hash"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/supports/utils"
+	"io"
+	"sync"
+)
+
+var InvalidCounterWidthErr = errors.New("counter width must be 4 or 8")
+
+// CountingDriver returns a driver of counting bloom filters, the "storage" field
+// selects where the counters live: memory (default), file or redis.
+func CountingDriver(redis contracts.RedisFactory) contracts.BloomFilterDriver {
+	return Must(CountingDriverE(redis))
+}
+
+// CountingDriverE is the equivalent to CountingDriver, but returns a *ConfigError instead of panicking.
+func CountingDriverE(redis contracts.RedisFactory) Driver {
+	return func(name string, config contracts.Fields) (contracts.BloomFilter, error) {
+		params, err := ParseParams(name, config)
+		if err != nil {
+			return nil, err
+		}
+		width := uint(utils.GetIntField(config, "counter", 4))
+		if width != 4 && width != 8 {
+			return nil, &ConfigError{Filter: name, Field: "counter", Err: InvalidCounterWidthErr}
+		}
+
+		switch storage := utils.GetStringField(config, "storage", "memory"); storage {
+		case "redis":
+			size, k := params.Estimate()
+			return &RedisCounting{
+				Len:    size,
+				K:      k,
+				Width:  width,
+				Items:  params.Items,
+				FPR:    params.FPR,
+				Hasher: params.Hasher,
+				Key:    redisKey(name, config),
+				Redis:  redis.Connection(utils.GetStringField(config, "connection")),
+			}, nil
+		case "file":
+			path, err := requiredString(name, config, "filepath")
+			if err != nil {
+				return nil, err
+			}
+			return &CountingFile{Counting: newCounting(name, params, width), filepath: path}, nil
+		case "memory":
+			return newCounting(name, params, width), nil
+		default:
+			return nil, &ConfigError{Filter: name, Field: "storage", Err: fmt.Errorf("%w: %s", InvalidFieldErr, storage)}
+		}
+	}
+}
+
+// newCounting creates an empty counting filter sized by params, width must be 4 or 8.
+func newCounting(name string, params Params, width uint) *Counting {
+	size, k := params.Estimate()
+	return &Counting{
+		name:     name,
+		size:     size,
+		k:        k,
+		width:    width,
+		capacity: params.Items,
+		fpr:      params.FPR,
+		hasher:   params.hasher(),
+		counters: make([]byte, (size*width+7)/8),
+	}
+}
+
+// Counting is an in-memory counting bloom filter, every slot holds a 4-bit or 8-bit
+// saturating counter instead of a single bit, so that items can be removed.
+// It is safe for concurrent use.
+type Counting struct {
+	name     string
+	size     uint
+	k        uint
+	width    uint
+	capacity uint
+	fpr      float64
+	hasher   hash.Hasher
+	counters []byte
+	// items counts the added items minus the removed ones.
+	items uint
+	mutex sync.RWMutex
+}
+
+// max returns the value at which a counter saturates.
+func (this *Counting) max() uint8 {
+	return uint8(1<<this.width - 1)
+}
+
+func (this *Counting) get(i uint) uint8 {
+	if this.width == 8 {
+		return this.counters[i]
+	}
+	return this.counters[i/2] >> (4 * (i % 2)) & 0x0f
+}
+
+func (this *Counting) set(i uint, value uint8) {
+	if this.width == 8 {
+		this.counters[i] = value
+		return
+	}
+	shift := 4 * (i % 2)
+	this.counters[i/2] = this.counters[i/2]&^(0x0f<<shift) | value<<shift
+}
+
+func (this *Counting) increment(i uint) {
+	if value := this.get(i); value < this.max() {
+		this.set(i, value+1)
+	}
+}
+
+// decrement lowers the counter, saturated counters are never decremented because
+// their real value is unknown.
+func (this *Counting) decrement(i uint) {
+	if value := this.get(i); value > 0 && value < this.max() {
+		this.set(i, value-1)
+	}
+}
+
+// location returns the ith hashed location using the four base hash values
+func (this *Counting) location(h [4]uint64, i uint) uint {
+	return uint(location(h, i) % uint64(this.size))
+}
+
+func (this *Counting) add(h [4]uint64) {
+	this.items++
+	for i := uint(0); i < this.k; i++ {
+		this.increment(this.location(h, i))
+	}
+}
+
+func (this *Counting) test(h [4]uint64) bool {
+	for i := uint(0); i < this.k; i++ {
+		if this.get(this.location(h, i)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (this *Counting) Add(bytes []byte) {
+	h := baseHashes(this.hasher, bytes)
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.add(h)
+}
+
+func (this *Counting) AddString(str string) {
+	this.Add([]byte(str))
+}
+
+func (this *Counting) Test(bytes []byte) bool {
+	h := baseHashes(this.hasher, bytes)
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	return this.test(h)
+}
+
+func (this *Counting) TestString(str string) bool {
+	return this.Test([]byte(str))
+}
+
+// TestAndAdd is the equivalent to calling Test(data) then Add(data).
+// Returns the result of Test.
+func (this *Counting) TestAndAdd(data []byte) bool {
+	h := baseHashes(this.hasher, data)
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	present := this.test(h)
+	this.add(h)
+	return present
+}
+
+// TestAndAddString is the equivalent to calling Test(string) then Add(string).
+// Returns the result of Test.
+func (this *Counting) TestAndAddString(data string) bool {
+	return this.TestAndAdd([]byte(data))
+}
+
+// TestOrAdd is the equivalent to calling Test(data) then if not present Add(data).
+// Returns the result of Test.
+func (this *Counting) TestOrAdd(data []byte) bool {
+	h := baseHashes(this.hasher, data)
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.test(h) {
+		return true
+	}
+	this.add(h)
+	return false
+}
+
+// TestOrAddString is the equivalent to calling Test(string) then if not present Add(string).
+// Returns the result of Test.
+func (this *Counting) TestOrAddString(data string) bool {
+	return this.TestOrAdd([]byte(data))
+}
+
+// AddMany is the equivalent to calling Add for every item.
+func (this *Counting) AddMany(items [][]byte) {
+	hashes := baseHashesMany(this.hasher, items)
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for _, h := range hashes {
+		this.add(h)
+	}
+}
+
+// TestMany is the equivalent to calling Test for every item, under a single lock.
+func (this *Counting) TestMany(items [][]byte) []bool {
+	hashes := baseHashesMany(this.hasher, items)
+	results := make([]bool, len(items))
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	for i, h := range hashes {
+		results[i] = this.test(h)
+	}
+	return results
+}
+
+// TestOrAddMany is the equivalent to calling TestOrAdd for every item, under a single lock.
+func (this *Counting) TestOrAddMany(items [][]byte) []bool {
+	hashes := baseHashesMany(this.hasher, items)
+	results := make([]bool, len(items))
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for i, h := range hashes {
+		if results[i] = this.test(h); !results[i] {
+			this.add(h)
+		}
+	}
+	return results
+}
+
+// Remove decrements the counters of data, it does nothing if data is not present.
+// Removing an item that was never added may cause false negatives.
+func (this *Counting) Remove(data []byte) {
+	h := baseHashes(this.hasher, data)
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if !this.test(h) {
+		return
+	}
+	for i := uint(0); i < this.k; i++ {
+		this.decrement(this.location(h, i))
+	}
+	if this.items > 0 {
+		this.items--
+	}
+}
+
+// RemoveString is the equivalent to calling Remove([]byte(string)).
+func (this *Counting) RemoveString(data string) {
+	this.Remove([]byte(data))
+}
+
+func (this *Counting) Clear() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for i := range this.counters {
+		this.counters[i] = 0
+	}
+	this.items = 0
+}
+
+func (this *Counting) Size() uint {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	return this.size
+}
+
+// Count returns the number of non-zero counters.
+func (this *Counting) Count() uint {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	count := uint(0)
+	for i := uint(0); i < this.size; i++ {
+		if this.get(i) > 0 {
+			count++
+		}
+	}
+	return count
+}
+
+func (this *Counting) Load() {
+}
+
+func (this *Counting) Save() {
+}
+
+// WriteTo writes a binary representation of the counting filter to an i/o stream:
+// a versioned header, the counters and a CRC32C trailer.
+// It returns the number of bytes written.
+func (this *Counting) WriteTo(stream io.Writer) (int64, error) {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	return writeEnvelope(stream, header{
+		Type:  filterTypeCounting,
+		Hash:  this.hasher.ID(),
+		Seed:  this.hasher.Seed(),
+		M:     uint64(this.size),
+		K:     uint64(this.k),
+		Count: uint64(this.items),
+	}, this.writePayload)
+}
+
+// writePayload writes size, k and the counter width followed by the counters.
+func (this *Counting) writePayload(stream io.Writer) (int64, error) {
+	for _, value := range []uint64{uint64(this.size), uint64(this.k), uint64(this.width)} {
+		if err := binary.Write(stream, binary.BigEndian, value); err != nil {
+			return 0, err
+		}
+	}
+	n, err := stream.Write(this.counters)
+	return int64(n + 3*binary.Size(uint64(0))), err
+}
+
+// ReadFrom reads a binary representation of the counting filter (such as might
+// have been written by WriteTo()) from an i/o stream, the header and the checksum are verified.
+// It returns the number of bytes read.
+func (this *Counting) ReadFrom(stream io.Reader) (int64, error) {
+	return readEnvelope(stream, filterTypeCounting, this.hasher, func(stream io.Reader) (int64, error) {
+		n, apply, err := this.readPayload(stream, nil)
+		if err == nil {
+			apply()
+		}
+		return n, err
+	}, func(h header, stream io.Reader) (int64, func(), error) {
+		return this.readPayload(stream, &h)
+	})
+}
+
+// readPayload reads what writePayload wrote, the returned function replaces the filter with it.
+// The size and k of the payload must be the ones of h, legacy streams have no header.
+func (this *Counting) readPayload(stream io.Reader, h *header) (int64, func(), error) {
+	var values [3]uint64
+	if err := binary.Read(stream, binary.BigEndian, &values); err != nil {
+		return 0, nil, err
+	}
+	if values[2] != 4 && values[2] != 8 {
+		return 0, nil, InvalidCounterWidthErr
+	}
+	if values[0] == 0 || values[0] > maxPayloadBits || values[1] == 0 || values[1] > values[0] {
+		return 0, nil, errors.New("invalid counting filter header")
+	}
+	items := uint(0)
+	if h != nil {
+		if h.M != values[0] || h.K != values[1] {
+			return 0, nil, errors.New("counting filter header does not match its payload")
+		}
+		items = uint(h.Count)
+	}
+	size, k, width := uint(values[0]), uint(values[1]), uint(values[2])
+	counters, err := readPayloadBytes(stream, (values[0]*values[2]+7)/8)
+	if err != nil {
+		return 0, nil, err
+	}
+	return int64(len(counters) + 3*binary.Size(uint64(0))), func() {
+		this.mutex.Lock()
+		defer this.mutex.Unlock()
+		this.size, this.k, this.width, this.counters, this.items = size, k, width, counters, items
+	}, nil
+}
+
+// CountingFile is a counting bloom filter that is loaded from and saved to a file.
+type CountingFile struct {
+	*Counting
+
+	filepath string
+}
+
+func (this *CountingFile) Load() {
+	loadFile(this.filepath, this)
+}
+
+func (this *CountingFile) Save() {
+	saveFile(this.filepath, this)
+}
+
+// LoadE is the equivalent to Load, but returns the error instead of logging it.
+func (this *CountingFile) LoadE() error {
+	return readFile(this.filepath, this)
+}
+
+// SaveE is the equivalent to Save, but returns the error instead of logging it.
+func (this *CountingFile) SaveE() error {
+	return writeFile(this.filepath, this)
+}
@@ -0,0 +1,479 @@
+package drivers
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/goal-web/bloomfilter/hash"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/supports/logs"
+	"io"
+	"math"
+	"math/bits"
+	"sync"
+)
+
+var CuckooFilterFullErr = errors.New("cuckoo filter is full")
+
+const (
+	cuckooBucketSize = 4
+	cuckooLoadFactor = 0.95
+	cuckooMaxKicks   = 500
+)
+
+// CuckooDriver creates a cuckoo filter, the "storage" field selects whether it
+// is kept in memory (default) or persisted to "filepath".
+func CuckooDriver(name string, config contracts.Fields) contracts.BloomFilter {
+	return Must(CuckooDriverE)(name, config)
+}
+
+// CuckooDriverE is the equivalent to CuckooDriver, but returns a *ConfigError instead of panicking.
+func CuckooDriverE(name string, config contracts.Fields) (contracts.BloomFilter, error) {
+	params, err := ParseParams(name, config)
+	if err == nil {
+		err = params.sizedByItems(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cuckoo := newSizedCuckoo(name, params)
+	return withFileStorage(name, config, cuckoo, func(path string) contracts.BloomFilter {
+		return &CuckooFile{Cuckoo: cuckoo, filepath: path}
+	})
+}
+
+// NewCuckoo creates a cuckoo filter for n items with the false positive probability p,
+// the fingerprint size is the smallest one that satisfies p with buckets of four entries.
+func NewCuckoo(name string, n uint, p float64) *Cuckoo {
+	return newSizedCuckoo(name, Params{Items: n, FPR: p})
+}
+
+// newSizedCuckoo creates a cuckoo filter sized by params, see NewCuckoo.
+func newSizedCuckoo(name string, params Params) *Cuckoo {
+	n, p := params.Items, params.FPR
+	fingerprint := uint(math.Ceil(math.Log2(2 * cuckooBucketSize / p)))
+	if fingerprint < 4 {
+		fingerprint = 4
+	} else if fingerprint > 32 {
+		fingerprint = 32
+	}
+	buckets := uint(math.Ceil(float64(n) / cuckooBucketSize / cuckooLoadFactor))
+	buckets = uint(1) << bits.Len(Max(buckets, 1)-1)
+	cuckoo := newCuckoo(name, buckets, fingerprint)
+	cuckoo.capacity, cuckoo.fpr, cuckoo.hasher = n, p, params.hasher()
+	return cuckoo
+}
+
+func newCuckoo(name string, buckets, fingerprint uint) *Cuckoo {
+	return &Cuckoo{
+		name:        name,
+		buckets:     buckets,
+		fingerprint: fingerprint,
+		table:       make([]uint64, (buckets*cuckooBucketSize*fingerprint+63)/64),
+	}
+}
+
+// Cuckoo is an in-memory cuckoo filter (Fan et al.), every bucket holds four
+// fingerprints packed into a word array. Unlike bloom filters items can be removed.
+// It is safe for concurrent use.
+type Cuckoo struct {
+	name        string
+	buckets     uint
+	fingerprint uint
+	table       []uint64
+	count       uint
+	// capacity and fpr are the configured number of items and false positive probability.
+	capacity uint
+	fpr      float64
+	hasher   hash.Hasher
+
+	// victim is the fingerprint that could not be relocated, once it is set the filter is full.
+	victim      uint32
+	victimIndex uint
+	// kicks drives the choice of the entry that is evicted while relocating.
+	kicks uint
+	mutex sync.RWMutex
+}
+
+// slot returns the fingerprint stored in the jth entry of the ith bucket.
+func (this *Cuckoo) slot(i, j uint) uint32 {
+	offset := (i*cuckooBucketSize + j) * this.fingerprint
+	word, shift := offset/64, offset%64
+	value := this.table[word] >> shift
+	if shift+this.fingerprint > 64 {
+		value |= this.table[word+1] << (64 - shift)
+	}
+	return uint32(value & (1<<this.fingerprint - 1))
+}
+
+func (this *Cuckoo) setSlot(i, j uint, fingerprint uint32) {
+	offset := (i*cuckooBucketSize + j) * this.fingerprint
+	word, shift := offset/64, offset%64
+	mask := uint64(1)<<this.fingerprint - 1
+	this.table[word] = this.table[word]&^(mask<<shift) | uint64(fingerprint)<<shift
+	if shift+this.fingerprint > 64 {
+		this.table[word+1] = this.table[word+1]&^(mask>>(64-shift)) | uint64(fingerprint)>>(64-shift)
+	}
+}
+
+// indexes returns the fingerprint of data and its two candidate buckets.
+func (this *Cuckoo) indexes(data []byte) (uint32, uint, uint) {
+	h := baseHashes(this.hasher, data)
+	fingerprint := uint32(h[1] & (1<<this.fingerprint - 1))
+	if fingerprint == 0 {
+		fingerprint = 1
+	}
+	i1 := uint(h[0]) & (this.buckets - 1)
+	return fingerprint, i1, this.altIndex(i1, fingerprint)
+}
+
+// altIndex returns the other candidate bucket of the fingerprint.
+func (this *Cuckoo) altIndex(i uint, fingerprint uint32) uint {
+	return (i ^ uint(uint64(fingerprint)*0x5bd1e995)) & (this.buckets - 1)
+}
+
+func (this *Cuckoo) contains(i uint, fingerprint uint32) bool {
+	for j := uint(0); j < cuckooBucketSize; j++ {
+		if this.slot(i, j) == fingerprint {
+			return true
+		}
+	}
+	return false
+}
+
+// copies returns the number of entries of the buckets i1 and i2 holding the fingerprint.
+func (this *Cuckoo) copies(fingerprint uint32, i1, i2 uint) uint {
+	copies := uint(0)
+	for _, i := range []uint{i1, i2} {
+		for j := uint(0); j < cuckooBucketSize; j++ {
+			if this.slot(i, j) == fingerprint {
+				copies++
+			}
+		}
+		if i1 == i2 {
+			break
+		}
+	}
+	return copies
+}
+
+// slots returns the number of entries of the buckets i1 and i2.
+func (this *Cuckoo) slots(i1, i2 uint) uint {
+	if i1 == i2 {
+		return cuckooBucketSize
+	}
+	return 2 * cuckooBucketSize
+}
+
+func (this *Cuckoo) insert(i uint, fingerprint uint32) bool {
+	for j := uint(0); j < cuckooBucketSize; j++ {
+		if this.slot(i, j) == 0 {
+			this.setSlot(i, j, fingerprint)
+			return true
+		}
+	}
+	return false
+}
+
+func (this *Cuckoo) delete(i uint, fingerprint uint32) bool {
+	for j := uint(0); j < cuckooBucketSize; j++ {
+		if this.slot(i, j) == fingerprint {
+			this.setSlot(i, j, 0)
+			return true
+		}
+	}
+	return false
+}
+
+// Add inserts the fingerprint of bytes, relocating existing entries when both buckets are full.
+// Every add stores a copy, so that removing an item once keeps the other adds of it and of the items sharing
+// its fingerprint, until the copies fill both buckets. Once an entry can not be relocated the filter is full, further adds are only stored when one of
+// their buckets has room, the others are logged as CuckooFilterFullErr.
+func (this *Cuckoo) Add(bytes []byte) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	fingerprint, i1, i2 := this.indexes(bytes)
+	this.add(fingerprint, i1, i2)
+}
+
+func (this *Cuckoo) add(fingerprint uint32, i1, i2 uint) {
+	// the adds of an item beyond the capacity of its buckets are not stored, they would evict the other items.
+	if this.copies(fingerprint, i1, i2) >= this.slots(i1, i2) {
+		return
+	}
+	if this.insert(i1, fingerprint) || this.insert(i2, fingerprint) {
+		this.count++
+		return
+	}
+	if this.victim != 0 {
+		logs.WithError(CuckooFilterFullErr).WithField("name", this.name).Error("bloomfilter.drivers.Cuckoo.Add: ")
+		return
+	}
+	this.count++
+	i := i2
+	for n := 0; n < cuckooMaxKicks; n++ {
+		this.kicks++
+		j := this.kicks % cuckooBucketSize
+		evicted := this.slot(i, j)
+		this.setSlot(i, j, fingerprint)
+		fingerprint, i = evicted, this.altIndex(i, evicted)
+		if this.insert(i, fingerprint) {
+			return
+		}
+	}
+	this.victim, this.victimIndex = fingerprint, i
+}
+
+func (this *Cuckoo) AddString(str string) {
+	this.Add([]byte(str))
+}
+
+func (this *Cuckoo) Test(bytes []byte) bool {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	fingerprint, i1, i2 := this.indexes(bytes)
+	return this.test(fingerprint, i1, i2)
+}
+
+func (this *Cuckoo) test(fingerprint uint32, i1, i2 uint) bool {
+	if this.victim == fingerprint && (this.victimIndex == i1 || this.victimIndex == i2) {
+		return true
+	}
+	return this.contains(i1, fingerprint) || this.contains(i2, fingerprint)
+}
+
+func (this *Cuckoo) TestString(str string) bool {
+	return this.Test([]byte(str))
+}
+
+// TestAndAdd is the equivalent to calling Test(data) then Add(data).
+// Returns the result of Test.
+func (this *Cuckoo) TestAndAdd(data []byte) bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	fingerprint, i1, i2 := this.indexes(data)
+	present := this.test(fingerprint, i1, i2)
+	this.add(fingerprint, i1, i2)
+	return present
+}
+
+// TestAndAddString is the equivalent to calling Test(string) then Add(string).
+// Returns the result of Test.
+func (this *Cuckoo) TestAndAddString(data string) bool {
+	return this.TestAndAdd([]byte(data))
+}
+
+// TestOrAdd is the equivalent to calling Test(data) then if not present Add(data).
+// Returns the result of Test.
+func (this *Cuckoo) TestOrAdd(data []byte) bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	fingerprint, i1, i2 := this.indexes(data)
+	if this.test(fingerprint, i1, i2) {
+		return true
+	}
+	this.add(fingerprint, i1, i2)
+	return false
+}
+
+// TestOrAddString is the equivalent to calling Test(string) then if not present Add(string).
+// Returns the result of Test.
+func (this *Cuckoo) TestOrAddString(data string) bool {
+	return this.TestOrAdd([]byte(data))
+}
+
+// AddMany is the equivalent to calling Add for every item.
+func (this *Cuckoo) AddMany(items [][]byte) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for _, item := range items {
+		this.add(this.indexes(item))
+	}
+}
+
+// TestMany is the equivalent to calling Test for every item, under a single lock.
+func (this *Cuckoo) TestMany(items [][]byte) []bool {
+	results := make([]bool, len(items))
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	for i, item := range items {
+		results[i] = this.test(this.indexes(item))
+	}
+	return results
+}
+
+// TestOrAddMany is the equivalent to calling TestOrAdd for every item, under a single lock.
+func (this *Cuckoo) TestOrAddMany(items [][]byte) []bool {
+	results := make([]bool, len(items))
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for i, item := range items {
+		fingerprint, i1, i2 := this.indexes(item)
+		if results[i] = this.test(fingerprint, i1, i2); !results[i] {
+			this.add(fingerprint, i1, i2)
+		}
+	}
+	return results
+}
+
+// Remove deletes a copy of the fingerprint of data. Removing an item that was never added
+// may remove another item.
+func (this *Cuckoo) Remove(data []byte) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	fingerprint, i1, i2 := this.indexes(data)
+	switch {
+	case this.victim == fingerprint && (this.victimIndex == i1 || this.victimIndex == i2):
+		this.victim = 0
+	case this.delete(i1, fingerprint) || this.delete(i2, fingerprint):
+		if this.victim != 0 {
+			// there is room again for the victim.
+			victim, i := this.victim, this.victimIndex
+			this.victim = 0
+			if !this.insert(i, victim) && !this.insert(this.altIndex(i, victim), victim) {
+				this.victim = victim
+			}
+		}
+	default:
+		return
+	}
+	this.count--
+}
+
+// RemoveString is the equivalent to calling Remove([]byte(string)).
+func (this *Cuckoo) RemoveString(data string) {
+	this.Remove([]byte(data))
+}
+
+func (this *Cuckoo) Clear() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for i := range this.table {
+		this.table[i] = 0
+	}
+	this.count, this.victim = 0, 0
+}
+
+// Size returns the number of entries of the filter.
+func (this *Cuckoo) Size() uint {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	return this.buckets * cuckooBucketSize
+}
+
+// Count returns the number of stored fingerprints.
+func (this *Cuckoo) Count() uint {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	return this.count
+}
+
+func (this *Cuckoo) Load() {
+}
+
+func (this *Cuckoo) Save() {
+}
+
+// WriteTo writes a binary representation of the cuckoo filter to an i/o stream:
+// a versioned header, the table and a CRC32C trailer.
+// It returns the number of bytes written.
+func (this *Cuckoo) WriteTo(stream io.Writer) (int64, error) {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	return writeEnvelope(stream, header{
+		Type:  filterTypeCuckoo,
+		Hash:  this.hasher.ID(),
+		Seed:  this.hasher.Seed(),
+		M:     uint64(this.buckets * cuckooBucketSize),
+		K:     uint64(this.fingerprint),
+		Count: uint64(this.count),
+	}, this.writePayload)
+}
+
+// writePayload writes the table dimensions, the count and the victim followed by the table.
+func (this *Cuckoo) writePayload(stream io.Writer) (int64, error) {
+	values := []uint64{
+		uint64(this.buckets),
+		uint64(this.fingerprint),
+		uint64(this.count),
+		uint64(this.victim),
+		uint64(this.victimIndex),
+	}
+	if err := binary.Write(stream, binary.BigEndian, values); err != nil {
+		return 0, err
+	}
+	if err := binary.Write(stream, binary.BigEndian, this.table); err != nil {
+		return 0, err
+	}
+	return int64(binary.Size(values) + binary.Size(this.table)), nil
+}
+
+// ReadFrom reads a binary representation of the cuckoo filter (such as might
+// have been written by WriteTo()) from an i/o stream, the header and the checksum are verified.
+// It returns the number of bytes read.
+func (this *Cuckoo) ReadFrom(stream io.Reader) (int64, error) {
+	return readEnvelope(stream, filterTypeCuckoo, this.hasher, func(stream io.Reader) (int64, error) {
+		n, apply, err := this.readPayload(stream)
+		if err == nil {
+			apply()
+		}
+		return n, err
+	}, func(h header, stream io.Reader) (int64, func(), error) {
+		return this.readPayload(stream)
+	})
+}
+
+// readPayload reads what writePayload wrote, the returned function replaces the filter with it.
+func (this *Cuckoo) readPayload(stream io.Reader) (int64, func(), error) {
+	values := make([]uint64, 5)
+	if err := binary.Read(stream, binary.BigEndian, values); err != nil {
+		return 0, nil, err
+	}
+	buckets, fingerprint, count, victim, victimIndex := values[0], values[1], values[2], values[3], values[4]
+	if buckets == 0 || buckets&(buckets-1) != 0 || buckets > maxPayloadBits/cuckooBucketSize || fingerprint < 4 || fingerprint > 32 {
+		return 0, nil, errors.New("invalid cuckoo filter header")
+	}
+	// the victim is stored outside of the table.
+	if count > buckets*cuckooBucketSize+1 || victimIndex >= buckets || victim >= 1<<fingerprint {
+		return 0, nil, errors.New("invalid cuckoo filter header")
+	}
+	words := (buckets*cuckooBucketSize*fingerprint + 63) / 64
+	data, err := readPayloadBytes(stream, 8*words)
+	if err != nil {
+		return 0, nil, err
+	}
+	table := make([]uint64, words)
+	for i := range table {
+		table[i] = binary.BigEndian.Uint64(data[8*i:])
+	}
+	return int64(binary.Size(values) + len(data)), func() {
+		this.mutex.Lock()
+		defer this.mutex.Unlock()
+		this.buckets, this.fingerprint, this.table = uint(buckets), uint(fingerprint), table
+		this.count, this.victim, this.victimIndex = uint(values[2]), uint32(values[3]), uint(values[4])
+	}, nil
+}
+
+// CuckooFile is a cuckoo filter that is loaded from and saved to a file.
+type CuckooFile struct {
+	*Cuckoo
+
+	filepath string
+}
+
+func (this *CuckooFile) Load() {
+	loadFile(this.filepath, this)
+}
+
+func (this *CuckooFile) Save() {
+	saveFile(this.filepath, this)
+}
+
+// LoadE is the equivalent to Load, but returns the error instead of logging it.
+func (this *CuckooFile) LoadE() error {
+	return readFile(this.filepath, this)
+}
+
+// SaveE is the equivalent to Save, but returns the error instead of logging it.
+func (this *CuckooFile) SaveE() error {
+	return writeFile(this.filepath, this)
+}
@@ -0,0 +1,95 @@
+package drivers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/supports/utils"
+	"time"
+)
+
+var MissingFieldErr = errors.New("field is required")
+var InvalidFieldErr = errors.New("invalid field value")
+
+// Driver creates a filter by name and configuration, it returns a *ConfigError instead of panicking
+// when the configuration is invalid.
+type Driver func(name string, config contracts.Fields) (contracts.BloomFilter, error)
+
+// Must adapts a Driver to contracts.BloomFilterDriver, errors are raised as panics.
+func Must(driver Driver) contracts.BloomFilterDriver {
+	return func(name string, config contracts.Fields) contracts.BloomFilter {
+		filter, err := driver(name, config)
+		if err != nil {
+			panic(err)
+		}
+		return filter
+	}
+}
+
+// ConfigError describes a filter that can not be created, Field is empty when the error
+// is not caused by a single field.
+type ConfigError struct {
+	Filter string
+	Field  string
+	Err    error
+}
+
+func (err *ConfigError) Error() string {
+	if err.Field == "" {
+		return fmt.Sprintf("bloomfilter %s: %v", err.Filter, err.Err)
+	}
+	return fmt.Sprintf("bloomfilter %s: field %s: %v", err.Filter, err.Field, err.Err)
+}
+
+func (err *ConfigError) Unwrap() error {
+	return err.Err
+}
+
+// requiredString returns the string field of config, or a *ConfigError when it is missing or empty.
+func requiredString(name string, config contracts.Fields, field string) (string, error) {
+	value, ok := config[field].(string)
+	if !ok || value == "" {
+		return "", &ConfigError{Filter: name, Field: field, Err: MissingFieldErr}
+	}
+	return value, nil
+}
+
+// durationField returns the duration field of config, given as a string such as "24h" or as a number of seconds,
+// or defaultValue when it is missing.
+func durationField(name string, config contracts.Fields, field string, defaultValue time.Duration) (time.Duration, error) {
+	return durationFieldIn(name, config, field, defaultValue, time.Second)
+}
+
+// durationFieldIn is the equivalent to durationField for a field whose numbers are a number of unit.
+func durationFieldIn(name string, config contracts.Fields, field string, defaultValue time.Duration, unit time.Duration) (time.Duration, error) {
+	switch value := config[field].(type) {
+	case nil:
+		return defaultValue, nil
+	case time.Duration:
+		return value, nil
+	case string:
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, &ConfigError{Filter: name, Field: field, Err: fmt.Errorf("%w: %s", InvalidFieldErr, value)}
+		}
+		return duration, nil
+	}
+	return time.Duration(utils.GetInt64Field(config, field)) * unit, nil
+}
+
+// withFileStorage returns filter when the "storage" field is memory (the default), or the filter
+// created by file with the "filepath" field when it is file.
+func withFileStorage(name string, config contracts.Fields, filter contracts.BloomFilter, file func(path string) contracts.BloomFilter) (contracts.BloomFilter, error) {
+	switch storage := utils.GetStringField(config, "storage", "memory"); storage {
+	case "memory":
+		return filter, nil
+	case "file":
+		path, err := requiredString(name, config, "filepath")
+		if err != nil {
+			return nil, err
+		}
+		return file(path), nil
+	default:
+		return nil, &ConfigError{Filter: name, Field: "storage", Err: fmt.Errorf("%w: %s", InvalidFieldErr, storage)}
+	}
+}
@@ -1,32 +1,72 @@
 package drivers
 
 import (
-	"encoding/binary"
-	"github.com/bits-and-blooms/bitset"
+	"bufio"
+	"errors"
+	"fmt"
 	"github.com/goal-web/bloomfilter/hash"
 	"github.com/goal-web/contracts"
 	"github.com/goal-web/supports/logs"
-	"github.com/goal-web/supports/utils"
 	"io"
+	"io/fs"
 	"math"
 	"os"
+	"path/filepath"
 )
 
+var CorruptFileErr = errors.New("bloom filter file is corrupt")
+
+// CorruptFileError is returned when a filter file can not be decoded,
+// it matches both CorruptFileErr and the decoding error.
+type CorruptFileError struct {
+	Path string
+	Err  error
+}
+
+func (err *CorruptFileError) Error() string {
+	return fmt.Sprintf("%s: %s: %v", CorruptFileErr, err.Path, err.Err)
+}
+
+func (err *CorruptFileError) Is(target error) bool {
+	return target == CorruptFileErr
+}
+
+func (err *CorruptFileError) Unwrap() error {
+	return err.Err
+}
+
 func FileDriver(name string, config contracts.Fields) contracts.BloomFilter {
-	size, k := EstimateParameters(
-		uint(utils.GetIntField(config, "Len", 0)),
-		utils.GetFloat64Field(config, "K", 0),
-	)
-	return &File{
-		name:     name,
-		size:     Max(size, 1),
-		k:        Max(k, 1),
-		bits:     bitset.New(size),
-		filepath: config["filepath"].(string),
+	return Must(FileDriverE)(name, config)
+}
+
+// FileDriverE is the equivalent to FileDriver, but returns a *ConfigError instead of panicking.
+func FileDriverE(name string, config contracts.Fields) (contracts.BloomFilter, error) {
+	path, err := requiredString(name, config, "filepath")
+	if err != nil {
+		return nil, err
+	}
+	params, err := ParseParams(name, config)
+	if err != nil {
+		return nil, err
+	}
+	enabled, interval, err := ParseWal(name, config)
+	if err != nil {
+		return nil, err
+	}
+	memory := newMemory(name, params)
+	memory.dirty = newDirtyPages(len(memory.bits.Bytes()))
+	if enabled {
+		memory.wal = newWal(path+".wal", memory.hasher, interval)
 	}
+	return &File{Memory: memory, filepath: path}, nil
 }
 
+// EstimateParameters returns the number of bits m and of hash functions k of a filter
+// holding n items with the false positive probability p, it returns zeros when n or p is out of range.
 func EstimateParameters(n uint, p float64) (m uint, k uint) {
+	if n == 0 || p <= 0 || p >= 1 {
+		return 0, 0
+	}
 	m = uint(math.Ceil(-1 * float64(n) * math.Log(p) / math.Pow(math.Log(2), 2)))
 	k = uint(math.Ceil(math.Log(2) * float64(m) / float64(n)))
 	return
@@ -41,178 +81,193 @@ func Max(x, y uint) uint {
 
 // baseHashes returns the four hash values of data that are used to create K
 // hashes
-func baseHashes(data []byte) [4]uint64 {
-	var d hash.Digest128 // murmur hashing
-	hash1, hash2, hash3, hash4 := d.Sum256(data)
+func baseHashes(hasher hash.Hasher, data []byte) [4]uint64 {
+	hash1, hash2, hash3, hash4 := hasher.Sum256(data)
 	return [4]uint64{
 		hash1, hash2, hash3, hash4,
 	}
 }
 
-type File struct {
-	name string
-	size uint
-	k    uint
-	bits *bitset.BitSet
-
-	filepath string
-}
-
-func (this *File) Add(bytes []byte) {
-	h := baseHashes(bytes)
-	for i := uint(0); i < this.k; i++ {
-		this.bits.Set(this.location(h, i))
+// baseHashesMany returns the base hashes of every item, so that they are computed
+// before a batch takes any lock.
+func baseHashesMany(hasher hash.Hasher, items [][]byte) [][4]uint64 {
+	hashes := make([][4]uint64, len(items))
+	for i, item := range items {
+		hashes[i] = baseHashes(hasher, item)
 	}
+	return hashes
 }
 
-// location returns the ith hashed location using the four base hash values
-func location(h [4]uint64, i uint) uint64 {
-	ii := uint64(i)
-	return h[ii%2] + ii*h[2+(((ii+(ii%2))%4)/2)]
-}
-
-// location returns the ith hashed location using the four base hash values
-func (this *File) location(h [4]uint64, i uint) uint {
-	return uint(location(h, i) % uint64(this.size))
-}
+// File is an in-memory bloom filter that is loaded from and saved to a file.
+// Save writes only the pages changed since the last save when the file has the layout of the filter.
+// With the "wal" field the adds since the last save are recorded in filepath.wal and replayed by Load.
+type File struct {
+	*Memory
 
-func (this *File) AddString(str string) {
-	this.Add([]byte(str))
+	filepath string
 }
 
-func (this *File) Test(bytes []byte) bool {
-	h := baseHashes(bytes)
-	for i := uint(0); i < this.k; i++ {
-		if !this.bits.Test(this.location(h, i)) {
-			return false
-		}
+func (this *File) Load() {
+	if err := this.LoadE(); err != nil {
+		logs.WithError(err).WithField("filepath", this.filepath).Error("bloomfilter.drivers.File.Load: file load failed")
 	}
-	return true
 }
 
-// TestAndAdd is the equivalent to calling Test(data) then Add(data).
-// Returns the result of Test.
-func (this *File) TestAndAdd(data []byte) bool {
-	present := true
-	h := baseHashes(data)
-	for i := uint(0); i < this.k; i++ {
-		l := this.location(h, i)
-		if !this.bits.Test(l) {
-			present = false
-		}
-		this.bits.Set(l)
+func (this *File) Save() {
+	if err := this.SaveE(); err != nil {
+		logs.WithError(err).WithField("filepath", this.filepath).Error("bloomfilter.drivers.File.Save: file save failed")
 	}
-	return present
 }
 
-// TestAndAddString is the equivalent to calling Test(string) then Add(string).
-// Returns the result of Test.
-func (this *File) TestAndAddString(data string) bool {
-	return this.TestAndAdd([]byte(data))
+// LoadE is the equivalent to Load, but returns the error instead of logging it.
+// The journal of an interrupted flush is replayed first, the write-ahead log over the file.
+func (this *File) LoadE() error {
+	if err := replayPages(this.filepath); err != nil {
+		return err
+	}
+	if err := readFile(this.filepath, this); err != nil || this.wal == nil {
+		return err
+	}
+	records, err := this.wal.replay()
+	if err != nil {
+		return err
+	}
+	this.replay(records)
+	return nil
 }
 
-// TestOrAdd is the equivalent to calling Test(data) then if not present Add(data).
-// Returns the result of Test.
-func (this *File) TestOrAdd(data []byte) bool {
-	present := true
-	h := baseHashes(data)
-	for i := uint(0); i < this.k; i++ {
-		l := this.location(h, i)
-		if !this.bits.Test(l) {
-			present = false
-			this.bits.Set(l)
+// SaveE is the equivalent to Save, but returns the error instead of logging it.
+// The write-ahead log is compacted once the file is written.
+func (this *File) SaveE() error {
+	this.dirty.saved()
+	if this.wal != nil {
+		this.mutex.Lock()
+		err := this.wal.rotate()
+		this.mutex.Unlock()
+		if err != nil {
+			return err
 		}
 	}
-	return present
-}
-
-// TestOrAddString is the equivalent to calling Test(string) then if not present Add(string).
-// Returns the result of Test.
-func (this *File) TestOrAddString(data string) bool {
-	return this.TestOrAdd([]byte(data))
+	if err := this.save(); err != nil || this.wal == nil {
+		return err
+	}
+	return this.wal.compact()
 }
 
-func (this *File) TestString(str string) bool {
-	return this.Test([]byte(str))
-}
+// save writes the dirty pages, or the whole file when they can not be written in place.
+func (this *File) save() error {
+	// the journal of a flush that failed is written first, the file is not consistent without it.
+	if err := replayPages(this.filepath); err != nil {
+		return err
+	}
+	if flushed, err := this.flush(); flushed || err != nil {
+		return err
+	}
 
-func (this *File) Clear() {
-	this.bits.ClearAll()
+	this.mutex.Lock()
+	this.dirty.take(0)
+	this.mutex.Unlock()
+	err := writeFile(this.filepath, this)
+	if err != nil {
+		this.mutex.RLock()
+		this.markDirty()
+		this.mutex.RUnlock()
+	}
+	return err
 }
 
-func (this *File) Size() uint {
-	return this.size
+// Close syncs and closes the write-ahead log, it is opened again by the next add.
+func (this *File) Close() error {
+	if this.wal == nil {
+		return nil
+	}
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.wal.Close()
 }
 
-func (this *File) Count() uint {
-	return this.bits.Count()
+// loadFile reads the filter from the file at path and logs the failure, see readFile.
+func loadFile(path string, filter io.ReaderFrom) {
+	if err := readFile(path, filter); err != nil {
+		logs.WithError(err).WithField("filepath", path).Error("bloomfilter.drivers.File.Load: file load failed")
+	}
 }
 
-func (this *File) Load() {
-	file, err := os.Open(this.filepath)
+// readFile reads the filter from the file at path. A missing file is not an error, the filter
+// starts empty; a file that can not be decoded returns an error wrapping CorruptFileErr, a file written
+// with another hash function one wrapping HasherMismatchErr. The filter is left untouched on failure.
+func readFile(path string, filter io.ReaderFrom) error {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		logs.WithField("filepath", path).Debug("bloomfilter.drivers.File.Load: file does not exist yet")
+		return nil
+	}
 	if err != nil {
-		logs.WithError(err).Debug("bloomfilter.drivers.File.Load: file open failed")
-		return
+		return err
 	}
+	defer file.Close()
 
-	_, err = this.ReadFrom(file)
+	_, err = filter.ReadFrom(bufio.NewReader(file))
 
+	if errors.Is(err, HasherMismatchErr) {
+		return fmt.Errorf("%s: %w", path, err)
+	}
 	if err != nil {
-		logs.WithError(err).Debug("bloomfilter.drivers.File.ReadFrom: file read failed")
-		return
+		return &CorruptFileError{Path: path, Err: err}
 	}
+	return nil
 }
 
-func (this *File) Save() {
-	file, err := os.OpenFile(this.filepath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
-	if err != nil {
-		logs.WithError(err).Error("bloomfilter.drivers.File.Save: file open failed")
-		return
+// saveFile writes the filter to the file at path and logs the failure, see writeFile.
+func saveFile(path string, filter io.WriterTo) {
+	if err := writeFile(path, filter); err != nil {
+		logs.WithError(err).WithField("filepath", path).Error("bloomfilter.drivers.File.Save: file save failed")
 	}
+}
 
-	_, err = this.WriteTo(file)
-
+// writeFile atomically replaces the file at path: the filter is written to a temporary file
+// in the same directory, synced to disk and renamed over path, so that a crash or a full disk
+// never leaves a truncated file behind.
+func writeFile(path string, filter io.WriterTo) (err error) {
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
 	if err != nil {
-		logs.WithError(err).Error("bloomfilter.drivers.File.WriteTo: file write failed")
-		return
+		return err
 	}
-}
+	defer func() {
+		if err != nil {
+			temp.Close()
+			os.Remove(temp.Name())
+		}
+	}()
 
-// WriteTo writes a binary representation of the BloomFilter to an i/o stream.
-// It returns the number of bytes written.
-func (this *File) WriteTo(stream io.Writer) (int64, error) {
-	err := binary.Write(stream, binary.BigEndian, uint64(this.size))
-	if err != nil {
-		return 0, err
+	writer := bufio.NewWriter(temp)
+	if _, err = filter.WriteTo(writer); err != nil {
+		return err
 	}
-	err = binary.Write(stream, binary.BigEndian, uint64(this.k))
-	if err != nil {
-		return 0, err
+	if err = writer.Flush(); err != nil {
+		return err
 	}
-	numBytes, err := this.bits.WriteTo(stream)
-	return numBytes + int64(2*binary.Size(uint64(0))), err
-}
-
-// ReadFrom reads a binary representation of the BloomFilter (such as might
-// have been written by WriteTo()) from an i/o stream. It returns the number
-// of bytes read.
-func (this *File) ReadFrom(stream io.Reader) (int64, error) {
-	var m, k uint64
-	err := binary.Read(stream, binary.BigEndian, &m)
-	if err != nil {
-		return 0, err
+	if err = temp.Chmod(0644); err != nil {
+		return err
 	}
-	err = binary.Read(stream, binary.BigEndian, &k)
-	if err != nil {
-		return 0, err
+	if err = temp.Sync(); err != nil {
+		return err
 	}
-	b := &bitset.BitSet{}
-	numBytes, err := b.ReadFrom(stream)
-	if err != nil {
-		return 0, err
+	if err = temp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(temp.Name(), path); err != nil {
+		return err
+	}
+
+	syncDir(path)
+	return nil
+}
+
+// syncDir persists the creation or the rename of the file at path, not every platform supports syncing a directory.
+func syncDir(path string) {
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
 	}
-	this.size = uint(m)
-	this.k = uint(k)
-	this.bits = b
-	return numBytes + int64(2*binary.Size(uint64(0))), nil
 }
@@ -0,0 +1,138 @@
+package drivers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/goal-web/bloomfilter/hash"
+	"hash/crc32"
+	"io"
+)
+
+var ChecksumMismatchErr = errors.New("checksum mismatch")
+var UnsupportedFormatErr = errors.New("unsupported format")
+var HasherMismatchErr = errors.New("file was written with another hash function")
+
+// formatMagic starts every file written by WriteTo, files without it are read with the legacy format.
+var formatMagic = [4]byte{'G', 'W', 'B', 'F'}
+
+const formatVersion uint16 = 1
+
+// filter types recorded in the header.
+const (
+	filterTypeBloom uint8 = iota + 1
+	filterTypeCounting
+	filterTypeScalable
+	filterTypeCuckoo
+	filterTypeWindow
+	filterTypeMmap
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// maxPayloadBits bounds the sizes read from a stream, so that computing the size of a table can not overflow.
+const maxPayloadBits uint64 = 1 << 48
+
+// readPayloadBytes reads n bytes, the buffer grows as they are read so that the size of a corrupt stream
+// fails with io.ErrUnexpectedEOF instead of being allocated.
+func readPayloadBytes(stream io.Reader, n uint64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(stream, int64(n)))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(data)) != n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return data, nil
+}
+
+// header follows the magic number and describes the filter, the payload is followed
+// by a CRC32C of the magic number, the header and the payload.
+type header struct {
+	Version uint16
+	Type    uint8
+	Hash    uint8
+	Flags   uint32
+	Seed    uint64
+	M       uint64
+	K       uint64
+	Count   uint64
+}
+
+// writeEnvelope writes the header, the payload and the checksum trailer.
+func writeEnvelope(stream io.Writer, h header, payload func(io.Writer) (int64, error)) (int64, error) {
+	h.Version = formatVersion
+	checksum := crc32.New(crc32c)
+	writer := io.MultiWriter(stream, checksum)
+	if _, err := writer.Write(formatMagic[:]); err != nil {
+		return 0, err
+	}
+	if err := binary.Write(writer, binary.BigEndian, h); err != nil {
+		return 0, err
+	}
+	written := int64(len(formatMagic) + binary.Size(h))
+	n, err := payload(writer)
+	written += n
+	if err != nil {
+		return written, err
+	}
+	if err = binary.Write(stream, binary.BigEndian, checksum.Sum32()); err != nil {
+		return written, err
+	}
+	return written + int64(binary.Size(uint32(0))), nil
+}
+
+// readEnvelope verifies the header and the checksum around the payload. Streams that do not start with
+// the magic number are handed to legacy. The payload must not change the filter before the checksum is verified,
+// it returns a function that applies what it read. The hash function and the seed recorded in the header must be
+// the ones of hasher, legacy streams were always hashed with murmur3 without seed.
+func readEnvelope(
+	stream io.Reader,
+	filterType uint8,
+	hasher hash.Hasher,
+	legacy func(io.Reader) (int64, error),
+	payload func(header, io.Reader) (int64, func(), error),
+) (int64, error) {
+	var magic [4]byte
+	if _, err := io.ReadFull(stream, magic[:]); err != nil {
+		return 0, err
+	}
+	if magic != formatMagic {
+		if hasher.ID() != hash.Murmur3ID || hasher.Seed() != 0 {
+			return 0, fmt.Errorf("%w: legacy files use murmur3, filter uses %s", HasherMismatchErr, hasher.Name())
+		}
+		return legacy(io.MultiReader(bytes.NewReader(magic[:]), stream))
+	}
+
+	checksum := crc32.New(crc32c)
+	checksum.Write(magic[:])
+	reader := io.TeeReader(stream, checksum)
+	var h header
+	if err := binary.Read(reader, binary.BigEndian, &h); err != nil {
+		return 0, err
+	}
+	if h.Version != formatVersion {
+		return 0, fmt.Errorf("%w: version %d", UnsupportedFormatErr, h.Version)
+	}
+	if h.Type != filterType {
+		return 0, fmt.Errorf("%w: filter type %d, expected %d", UnsupportedFormatErr, h.Type, filterType)
+	}
+	if h.Hash != hasher.ID() || h.Seed != hasher.Seed() {
+		return 0, fmt.Errorf("%w: hash function %d (seed %d), filter uses %s", HasherMismatchErr, h.Hash, h.Seed, hasher.Name())
+	}
+
+	n, apply, err := payload(h, reader)
+	if err != nil {
+		return 0, err
+	}
+	var sum uint32
+	if err = binary.Read(stream, binary.BigEndian, &sum); err != nil {
+		return 0, err
+	}
+	if sum != checksum.Sum32() {
+		return 0, ChecksumMismatchErr
+	}
+	apply()
+	return int64(len(magic)+binary.Size(h)+binary.Size(sum)) + n, nil
+}
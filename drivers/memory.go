@@ -0,0 +1,358 @@
+package drivers
+
+import (
+	"encoding/binary"
+	"github.com/bits-and-blooms/bitset"
+	"github.com/goal-web/bloomfilter/hash"
+	"github.com/goal-web/contracts"
+	"io"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+)
+
+func MemoryDriver(name string, config contracts.Fields) contracts.BloomFilter {
+	return Must(MemoryDriverE)(name, config)
+}
+
+// MemoryDriverE is the equivalent to MemoryDriver, but returns an error instead of panicking.
+func MemoryDriverE(name string, config contracts.Fields) (contracts.BloomFilter, error) {
+	params, err := ParseParams(name, config)
+	if err != nil {
+		return nil, err
+	}
+	return newMemory(name, params), nil
+}
+
+// NewMemory creates an in-memory bloom filter for n items with the false positive probability p.
+func NewMemory(name string, n uint, p float64) *Memory {
+	return newMemory(name, Params{Items: n, FPR: p})
+}
+
+// newMemory creates an in-memory bloom filter sized by params.
+func newMemory(name string, params Params) *Memory {
+	size, k := params.Estimate()
+	return &Memory{
+		name:     name,
+		size:     size,
+		k:        k,
+		capacity: params.Items,
+		fpr:      params.FPR,
+		hasher:   params.hasher(),
+		bits:     bitset.New(size),
+	}
+}
+
+// Memory is a bloom filter that lives only in the process memory,
+// Load and Save are no-ops.
+// It is safe for concurrent use: bits are set and tested with atomic word operations
+// under a shared lock, while Clear and the serialization take the lock exclusively.
+type Memory struct {
+	name string
+	size uint
+	k    uint
+	// capacity and fpr are the configured number of items and false positive probability.
+	capacity uint
+	fpr      float64
+	hasher   hash.Hasher
+	bits     *bitset.BitSet
+	// items counts the adds that changed the filter.
+	items atomic.Uint64
+	// dirty tracks the pages changed since the file was saved, it is nil when the filter has no file.
+	dirty *dirtyPages
+	// wal records the adds since the file was saved, it is nil unless the "wal" field is set.
+	wal   *wal
+	mutex sync.RWMutex
+}
+
+// setBit sets the ith bit of words and returns whether it was already set.
+func setBit(words []uint64, i uint) bool {
+	word, mask := &words[i/64], uint64(1)<<(i%64)
+	for {
+		old := atomic.LoadUint64(word)
+		if old&mask != 0 {
+			return true
+		}
+		if atomic.CompareAndSwapUint64(word, old, old|mask) {
+			return false
+		}
+	}
+}
+
+// testBit returns whether the ith bit of words is set.
+func testBit(words []uint64, i uint) bool {
+	return atomic.LoadUint64(&words[i/64])&(uint64(1)<<(i%64)) != 0
+}
+
+// setBit sets the ith bit of words and marks its page dirty when it changed, the caller must hold the shared lock.
+func (this *Memory) setBit(words []uint64, i uint) bool {
+	if setBit(words, i) {
+		return true
+	}
+	if this.dirty != nil {
+		this.dirty.mark(i)
+	}
+	return false
+}
+
+// wrote counts an add that changed the filter.
+func (this *Memory) wrote() {
+	this.items.Add(1)
+	if this.dirty != nil {
+		this.dirty.wrote()
+	}
+}
+
+// markDirty marks every page dirty, the caller must hold the lock.
+func (this *Memory) markDirty() {
+	if this.dirty != nil {
+		this.dirty.markAll()
+	}
+}
+
+func (this *Memory) Add(bytes []byte) {
+	this.TestAndAdd(bytes)
+}
+
+// location returns the ith hashed location using the four base hash values
+func location(h [4]uint64, i uint) uint64 {
+	ii := uint64(i)
+	return h[ii%2] + ii*h[2+(((ii+(ii%2))%4)/2)]
+}
+
+// location returns the ith hashed location using the four base hash values
+func (this *Memory) location(h [4]uint64, i uint) uint {
+	return uint(location(h, i) % uint64(this.size))
+}
+
+func (this *Memory) AddString(str string) {
+	this.Add([]byte(str))
+}
+
+func (this *Memory) Test(bytes []byte) bool {
+	h := baseHashes(this.hasher, bytes)
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	return this.test(this.bits.Bytes(), h)
+}
+
+// test returns whether all the bits of h are set, the caller must hold the shared lock.
+func (this *Memory) test(words []uint64, h [4]uint64) bool {
+	for i := uint(0); i < this.k; i++ {
+		if !testBit(words, this.location(h, i)) {
+			return false
+		}
+	}
+	return true
+}
+
+// add sets all the bits of h and returns whether they were already set, the caller must hold the shared lock.
+func (this *Memory) add(words []uint64, h [4]uint64) bool {
+	present := true
+	for i := uint(0); i < this.k; i++ {
+		if !this.setBit(words, this.location(h, i)) {
+			present = false
+		}
+	}
+	if !present {
+		this.wrote()
+	}
+	return present
+}
+
+// log records the items that are not present in the write-ahead log before they are added,
+// the caller must hold the shared lock.
+func (this *Memory) log(words []uint64, hashes ...[4]uint64) {
+	if this.wal == nil {
+		return
+	}
+	missing := make([][4]uint64, 0, len(hashes))
+	for _, h := range hashes {
+		if !this.test(words, h) {
+			missing = append(missing, h)
+		}
+	}
+	if len(missing) > 0 {
+		this.wal.append(walAdd, missing...)
+	}
+}
+
+// TestAndAdd is the equivalent to calling Test(data) then Add(data).
+// Returns the result of Test.
+func (this *Memory) TestAndAdd(data []byte) bool {
+	h := baseHashes(this.hasher, data)
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	words := this.bits.Bytes()
+	this.log(words, h)
+	return this.add(words, h)
+}
+
+// TestAndAddString is the equivalent to calling Test(string) then Add(string).
+// Returns the result of Test.
+func (this *Memory) TestAndAddString(data string) bool {
+	return this.TestAndAdd([]byte(data))
+}
+
+// TestOrAdd is the equivalent to calling Test(data) then if not present Add(data).
+// Setting the bits of a present item changes nothing, so it is the same as TestAndAdd.
+// Returns the result of Test.
+func (this *Memory) TestOrAdd(data []byte) bool {
+	return this.TestAndAdd(data)
+}
+
+// TestOrAddString is the equivalent to calling Test(string) then if not present Add(string).
+// Returns the result of Test.
+func (this *Memory) TestOrAddString(data string) bool {
+	return this.TestOrAdd([]byte(data))
+}
+
+func (this *Memory) TestString(str string) bool {
+	return this.Test([]byte(str))
+}
+
+// AddMany is the equivalent to calling Add for every item.
+func (this *Memory) AddMany(items [][]byte) {
+	this.TestOrAddMany(items)
+}
+
+// TestMany is the equivalent to calling Test for every item, under a single lock.
+func (this *Memory) TestMany(items [][]byte) []bool {
+	hashes := baseHashesMany(this.hasher, items)
+	results := make([]bool, len(items))
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	words := this.bits.Bytes()
+	for n, h := range hashes {
+		results[n] = this.test(words, h)
+	}
+	return results
+}
+
+// TestOrAddMany is the equivalent to calling TestOrAdd for every item, under a single lock.
+func (this *Memory) TestOrAddMany(items [][]byte) []bool {
+	hashes := baseHashesMany(this.hasher, items)
+	results := make([]bool, len(items))
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	words := this.bits.Bytes()
+	this.log(words, hashes...)
+	for n, h := range hashes {
+		results[n] = this.add(words, h)
+	}
+	return results
+}
+
+func (this *Memory) Clear() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.wal != nil {
+		this.wal.append(walClear, [4]uint64{})
+	}
+	this.bits.ClearAll()
+	this.items.Store(0)
+	this.markDirty()
+}
+
+func (this *Memory) Size() uint {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	return this.size
+}
+
+func (this *Memory) Count() uint {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	count := 0
+	for i := range this.bits.Bytes() {
+		count += bits.OnesCount64(atomic.LoadUint64(&this.bits.Bytes()[i]))
+	}
+	return uint(count)
+}
+
+func (this *Memory) Load() {
+}
+
+func (this *Memory) Save() {
+}
+
+// WriteTo writes a binary representation of the BloomFilter to an i/o stream:
+// a versioned header, the bitset and a CRC32C trailer.
+// It returns the number of bytes written.
+func (this *Memory) WriteTo(stream io.Writer) (int64, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return writeEnvelope(stream, this.header(), this.bits.WriteTo)
+}
+
+// ReadFrom reads a binary representation of the BloomFilter (such as might
+// have been written by WriteTo()) from an i/o stream, the header and the checksum are verified.
+// Files written before the header existed are still accepted. It returns the number
+// of bytes read.
+func (this *Memory) ReadFrom(stream io.Reader) (int64, error) {
+	return readEnvelope(stream, filterTypeBloom, this.hasher, this.readLegacy, func(h header, stream io.Reader) (int64, func(), error) {
+		b := &bitset.BitSet{}
+		numBytes, err := b.ReadFrom(stream)
+		if err != nil {
+			return 0, nil, err
+		}
+		if h.M == 0 || b.Len() < uint(h.M) {
+			return 0, nil, io.ErrUnexpectedEOF
+		}
+		return numBytes, func() {
+			this.replace(uint(h.M), uint(h.K), b, h.Count)
+		}, nil
+	})
+}
+
+// readLegacy reads the format without header: m and k followed by the bitset.
+func (this *Memory) readLegacy(stream io.Reader) (int64, error) {
+	var m, k uint64
+	err := binary.Read(stream, binary.BigEndian, &m)
+	if err != nil {
+		return 0, err
+	}
+	err = binary.Read(stream, binary.BigEndian, &k)
+	if err != nil {
+		return 0, err
+	}
+	b := &bitset.BitSet{}
+	numBytes, err := b.ReadFrom(stream)
+	if err != nil {
+		return 0, err
+	}
+	if m == 0 || b.Len() < uint(m) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	this.replace(uint(m), uint(k), b, 0)
+	return numBytes + int64(2*binary.Size(uint64(0))), nil
+}
+
+// replay applies the records of a write-ahead log, they are not recorded again.
+func (this *Memory) replay(records []walRecord) {
+	for _, record := range records {
+		if record.kind == walClear {
+			this.mutex.Lock()
+			this.bits.ClearAll()
+			this.items.Store(0)
+			this.markDirty()
+			this.mutex.Unlock()
+			continue
+		}
+		this.mutex.RLock()
+		this.add(this.bits.Bytes(), record.hashes)
+		this.mutex.RUnlock()
+	}
+}
+
+func (this *Memory) replace(m, k uint, b *bitset.BitSet, items uint64) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.size = m
+	this.k = k
+	this.bits = b
+	this.items.Store(items)
+	if this.dirty != nil {
+		this.dirty.resize(len(b.Bytes()))
+	}
+}
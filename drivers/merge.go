@@ -0,0 +1,193 @@
+package drivers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bits-and-blooms/bitset"
+	"github.com/goal-web/contracts"
+	"time"
+)
+
+var IncompatibleFilterErr = errors.New("filters are not compatible")
+
+// compatible returns an error wrapping IncompatibleFilterErr when the filters described by a and b
+// do not map items to the same bits.
+func compatible(a, b header) error {
+	switch {
+	case a.M != b.M:
+		return fmt.Errorf("%w: %d bits, other has %d", IncompatibleFilterErr, a.M, b.M)
+	case a.K != b.K:
+		return fmt.Errorf("%w: %d hash functions, other has %d", IncompatibleFilterErr, a.K, b.K)
+	case a.Hash != b.Hash || a.Seed != b.Seed:
+		return fmt.Errorf("%w: hash function %d (seed %d), other has %d (seed %d)", IncompatibleFilterErr, a.Hash, a.Seed, b.Hash, b.Seed)
+	}
+	return nil
+}
+
+// memoryFilter is implemented by the drivers that keep a *Memory, such as File.
+type memoryFilter interface {
+	memory() *Memory
+}
+
+func (this *Memory) memory() *Memory {
+	return this
+}
+
+// header describes the parameters of the filter, the caller must hold the lock.
+func (this *Memory) header() header {
+	return header{
+		Type:  filterTypeBloom,
+		Hash:  this.hasher.ID(),
+		Seed:  this.hasher.Seed(),
+		M:     uint64(this.size),
+		K:     uint64(this.k),
+		Count: this.items.Load(),
+	}
+}
+
+// snapshot returns a copy of the bits of the filter with its header.
+func (this *Memory) snapshot() (*bitset.BitSet, header) {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	return this.bits.Clone(), this.header()
+}
+
+// Union sets the bits of other in this filter, so that it contains the items of both filters.
+// other must be a memory or file filter with the same number of bits, hash functions and hash function.
+func (this *Memory) Union(other contracts.BloomFilter) error {
+	return this.Merge(other)
+}
+
+// Intersect keeps only the bits that are also set in other, the result tests positive for the items
+// of both filters and may have a higher false positive rate than a filter built from them.
+func (this *Memory) Intersect(other contracts.BloomFilter) error {
+	return this.combine([]contracts.BloomFilter{other}, (*bitset.BitSet).InPlaceIntersection, func(a, b uint64) uint64 {
+		if b < a {
+			return b
+		}
+		return a
+	})
+}
+
+// Merge is the equivalent to calling Union for every filter, nothing is changed when one of them is not compatible.
+func (this *Memory) Merge(others ...contracts.BloomFilter) error {
+	return this.combine(others, (*bitset.BitSet).InPlaceUnion, func(a, b uint64) uint64 {
+		return a + b
+	})
+}
+
+// combine applies op with the bits of others, they are copied first so that no two locks are held at once.
+// count combines the numbers of items added, which are an upper bound after the operation.
+func (this *Memory) combine(others []contracts.BloomFilter, op func(*bitset.BitSet, *bitset.BitSet), count func(a, b uint64) uint64) error {
+	snapshots := make([]*bitset.BitSet, len(others))
+	headers := make([]header, len(others))
+	for i, other := range others {
+		filter, ok := other.(memoryFilter)
+		if !ok {
+			return fmt.Errorf("%w: %T can not be combined with a memory filter", IncompatibleFilterErr, other)
+		}
+		snapshots[i], headers[i] = filter.memory().snapshot()
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for _, h := range headers {
+		if err := compatible(this.header(), h); err != nil {
+			return err
+		}
+	}
+	items := this.items.Load()
+	for i, snapshot := range snapshots {
+		op(this.bits, snapshot)
+		items = count(items, headers[i].Count)
+	}
+	this.items.Store(items)
+	this.markDirty()
+	if this.dirty != nil {
+		this.dirty.wrote()
+	}
+	return nil
+}
+
+// Union is the equivalent to Memory.Union, the file is saved when the filter has a write-ahead log.
+func (this *File) Union(other contracts.BloomFilter) error {
+	return this.Merge(other)
+}
+
+// Intersect is the equivalent to Memory.Intersect, the file is saved when the filter has a write-ahead log.
+func (this *File) Intersect(other contracts.BloomFilter) error {
+	return this.saveCombined(this.Memory.Intersect(other))
+}
+
+// Merge is the equivalent to Memory.Merge, the file is saved when the filter has a write-ahead log.
+func (this *File) Merge(others ...contracts.BloomFilter) error {
+	return this.saveCombined(this.Memory.Merge(others...))
+}
+
+// saveCombined saves the filter after a successful combination: the write-ahead log records items, not bits,
+// so the combination would be lost by a replay of the log over the previous file.
+func (this *File) saveCombined(err error) error {
+	if err != nil || this.wal == nil {
+		return err
+	}
+	return this.SaveE()
+}
+
+// header describes the parameters of the filter.
+func (this *Redis) header() header {
+	hasher := this.hasher()
+	return header{Type: filterTypeBloom, Hash: hasher.ID(), Seed: hasher.Seed(), M: uint64(this.Len), K: uint64(this.K)}
+}
+
+// Union sets the bits of other in this filter with a server side BITOP OR per segment.
+// other must be a redis filter with the same number of bits, hash functions and segments, in a cluster
+// the keys of both filters must be in the same slot.
+func (this *Redis) Union(other contracts.BloomFilter) error {
+	return this.Merge(other)
+}
+
+// Intersect keeps only the bits that are also set in other with a server side BITOP AND per segment.
+func (this *Redis) Intersect(other contracts.BloomFilter) error {
+	return this.combine([]contracts.BloomFilter{other}, this.Redis.BitOpAnd)
+}
+
+// Merge is the equivalent to calling Union for every filter, with a single BITOP OR per segment.
+func (this *Redis) Merge(others ...contracts.BloomFilter) error {
+	return this.combine(others, this.Redis.BitOpOr)
+}
+
+// combine stores the result of bitop over the segments of this filter and others in this filter.
+func (this *Redis) combine(others []contracts.BloomFilter, bitop func(destKey string, keys ...string) (int64, error)) error {
+	filters := make([]*Redis, len(others))
+	for i, other := range others {
+		filter, ok := other.(*Redis)
+		if !ok {
+			return fmt.Errorf("%w: %T can not be combined with a redis filter", IncompatibleFilterErr, other)
+		}
+		if err := compatible(this.header(), filter.header()); err != nil {
+			return err
+		}
+		if filter.segmentBits() != this.segmentBits() {
+			return fmt.Errorf("%w: %d bits per segment, other has %d", IncompatibleFilterErr, this.segmentBits(), filter.segmentBits())
+		}
+		filters[i] = filter
+	}
+
+	for i := uint64(0); i < this.segments(); i++ {
+		keys := []string{this.segmentKey(i)}
+		for _, filter := range filters {
+			keys = append(keys, filter.segmentKey(i))
+		}
+		if _, err := bitop(keys[0], keys...); err != nil {
+			return fmt.Errorf("bloomfilter %s: %w", this.Key, err)
+		}
+	}
+	// BITOP replaces the keys, and with them their time to live.
+	if !this.ExpiresAt.IsZero() {
+		return this.ExpireAt(this.ExpiresAt)
+	}
+	if this.Expire > 0 {
+		return this.ExpireAt(time.Now().Add(this.Expire))
+	}
+	return nil
+}
@@ -0,0 +1,437 @@
+package drivers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/goal-web/bloomfilter/hash"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/supports/logs"
+	"hash/crc32"
+	"io"
+	"math/bits"
+	"os"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+var MmapUnsupportedErr = errors.New("mmap is not supported on this platform")
+
+// mmapDataOffset is the offset of the bits in a mapped file, the first page holds the header.
+const mmapDataOffset = 4096
+
+// littleEndian tells whether the host stores the least significant byte of a word first.
+var littleEndian = func() bool {
+	word := uint32(1)
+	return *(*byte)(unsafe.Pointer(&word)) == 1
+}()
+
+func MmapDriver(name string, config contracts.Fields) contracts.BloomFilter {
+	return Must(MmapDriverE)(name, config)
+}
+
+// MmapDriverE is the equivalent to MmapDriver, but returns a *ConfigError instead of panicking.
+// On the platforms without mmap the error wraps MmapUnsupportedErr.
+func MmapDriverE(name string, config contracts.Fields) (contracts.BloomFilter, error) {
+	if !mmapSupported {
+		return nil, &ConfigError{Filter: name, Field: "driver", Err: MmapUnsupportedErr}
+	}
+	path, err := requiredString(name, config, "filepath")
+	if err != nil {
+		return nil, err
+	}
+	params, err := ParseParams(name, config)
+	if err != nil {
+		return nil, err
+	}
+	return newMmap(name, path, params), nil
+}
+
+// NewMmap creates a bloom filter mapped from the file at path, a new file is sized for n items
+// with the false positive probability p.
+func NewMmap(name, path string, n uint, p float64) *Mmap {
+	return newMmap(name, path, Params{Items: n, FPR: p})
+}
+
+// newMmap creates a bloom filter mapped from the file at path, a new file is sized by params.
+func newMmap(name, path string, params Params) *Mmap {
+	size, k := params.Estimate()
+	return &Mmap{
+		name:     name,
+		filepath: path,
+		size:     size,
+		k:        k,
+		capacity: params.Items,
+		fpr:      params.FPR,
+		hasher:   params.hasher(),
+	}
+}
+
+// Mmap is a bloom filter whose bits are a file mapped in memory. Bits are set and tested in place,
+// pages are read from the file when they are first touched and the page cache is shared with the other
+// processes that map the same file. The file is mapped by Load, or by the first call that needs it,
+// Save writes the dirty pages back and Close unmaps it. A new file is sized by the configuration,
+// an existing one keeps the number of bits and hash functions it was created with.
+// It is safe for concurrent use.
+type Mmap struct {
+	name     string
+	filepath string
+	size     uint
+	k        uint
+	capacity uint
+	fpr      float64
+	hasher   hash.Hasher
+
+	file *os.File
+	// data is the whole mapping, words are the bits that follow the header page.
+	data  []byte
+	words []uint32
+	// items counts the adds that changed the filter, it is stored in the header by Save.
+	items atomic.Uint64
+	// notifier is signaled after the number of writes set by NotifyWrites.
+	notifier atomic.Pointer[writeNotifier]
+	// mutex is held exclusively to map and unmap the file, saveMutex serializes the writes of the header.
+	mutex     sync.RWMutex
+	saveMutex sync.Mutex
+}
+
+// mmapWords returns the number of 32 bits words holding m bits.
+func mmapWords(m uint64) int {
+	return int((m + 31) / 32)
+}
+
+// mmapBit returns the index of the word holding the ith bit and its mask. Bits are numbered from the least
+// significant bit of the first byte of the file, so that files do not depend on the byte order of the host.
+func mmapBit(i uint) (int, uint32) {
+	shift := i % 32
+	if !littleEndian {
+		shift = (3-shift/8)*8 + shift%8
+	}
+	return int(i / 32), 1 << shift
+}
+
+// encodeMmapHeader returns the magic number, the header and a CRC32C of both.
+func encodeMmapHeader(h header) []byte {
+	h.Version = formatVersion
+	var buffer bytes.Buffer
+	buffer.Write(formatMagic[:])
+	_ = binary.Write(&buffer, binary.BigEndian, h)
+	return binary.BigEndian.AppendUint32(buffer.Bytes(), crc32.Checksum(buffer.Bytes(), crc32c))
+}
+
+// header describes the parameters of the filter.
+func (this *Mmap) header() header {
+	return header{
+		Type:  filterTypeMmap,
+		Hash:  this.hasher.ID(),
+		Seed:  this.hasher.Seed(),
+		M:     uint64(this.size),
+		K:     uint64(this.k),
+		Count: this.items.Load(),
+	}
+}
+
+// open maps the file, creating it when it does not exist, the caller must hold the lock exclusively.
+func (this *Mmap) open() error {
+	file, err := os.OpenFile(this.filepath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	h, err := this.prepare(file)
+	var data []byte
+	if err == nil {
+		data, err = mmap(file, mmapDataOffset+4*mmapWords(h.M))
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+	this.file, this.data = file, data
+	this.words = unsafe.Slice((*uint32)(unsafe.Pointer(&data[mmapDataOffset])), mmapWords(h.M))
+	this.size, this.k = uint(h.M), uint(h.K)
+	this.items.Store(h.Count)
+	return nil
+}
+
+// prepare returns the header of file, an empty file is sized for the configured filter first.
+func (this *Mmap) prepare(file *os.File) (header, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return header{}, err
+	}
+	if info.Size() == 0 {
+		h := this.header()
+		if err = file.Truncate(int64(mmapDataOffset + 4*mmapWords(h.M))); err != nil {
+			return h, err
+		}
+		_, err = file.WriteAt(encodeMmapHeader(h), 0)
+		return h, err
+	}
+
+	encoded := make([]byte, len(encodeMmapHeader(header{})))
+	if _, err = file.ReadAt(encoded, 0); err != nil {
+		return header{}, &CorruptFileError{Path: this.filepath, Err: err}
+	}
+	if !bytes.Equal(encoded[:len(formatMagic)], formatMagic[:]) {
+		return header{}, &CorruptFileError{Path: this.filepath, Err: fmt.Errorf("%w: not a mapped filter", UnsupportedFormatErr)}
+	}
+	var h header
+	_ = binary.Read(bytes.NewReader(encoded[len(formatMagic):]), binary.BigEndian, &h)
+	sum := binary.BigEndian.Uint32(encoded[len(encoded)-4:])
+	switch {
+	case sum != crc32.Checksum(encoded[:len(encoded)-4], crc32c):
+		err = ChecksumMismatchErr
+	case h.Version != formatVersion:
+		err = fmt.Errorf("%w: version %d", UnsupportedFormatErr, h.Version)
+	case h.Type != filterTypeMmap:
+		err = fmt.Errorf("%w: filter type %d, expected %d", UnsupportedFormatErr, h.Type, filterTypeMmap)
+	case h.Hash != this.hasher.ID() || h.Seed != this.hasher.Seed():
+		return h, fmt.Errorf("%s: %w: hash function %d (seed %d), filter uses %s", this.filepath, HasherMismatchErr, h.Hash, h.Seed, this.hasher.Name())
+	case h.M == 0 || h.K == 0 || info.Size() < int64(mmapDataOffset+4*mmapWords(h.M)):
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return h, &CorruptFileError{Path: this.filepath, Err: err}
+	}
+	return h, nil
+}
+
+// rlock takes the shared lock with the file mapped, mapping it first when needed.
+// It returns false, without the lock, when the file can not be mapped.
+func (this *Mmap) rlock() bool {
+	for {
+		this.mutex.RLock()
+		if this.words != nil {
+			return true
+		}
+		this.mutex.RUnlock()
+		if err := this.LoadE(); err != nil {
+			logs.WithError(err).WithField("filepath", this.filepath).Error("bloomfilter.drivers.Mmap: failed to map the file")
+			return false
+		}
+	}
+}
+
+// location returns the ith hashed location using the four base hash values
+func (this *Mmap) location(h [4]uint64, i uint) uint {
+	return uint(location(h, i) % uint64(this.size))
+}
+
+// test returns whether all the bits of h are set, the caller must hold the shared lock.
+func (this *Mmap) test(h [4]uint64) bool {
+	for i := uint(0); i < this.k; i++ {
+		word, mask := mmapBit(this.location(h, i))
+		if atomic.LoadUint32(&this.words[word])&mask == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// testAndAdd sets all the bits of h and returns whether they were already set, the caller must hold the shared lock.
+func (this *Mmap) testAndAdd(h [4]uint64) bool {
+	present := true
+	for i := uint(0); i < this.k; i++ {
+		word, mask := mmapBit(this.location(h, i))
+		for {
+			old := atomic.LoadUint32(&this.words[word])
+			if old&mask != 0 {
+				break
+			}
+			if atomic.CompareAndSwapUint32(&this.words[word], old, old|mask) {
+				present = false
+				break
+			}
+		}
+	}
+	if !present {
+		this.items.Add(1)
+		if notifier := this.notifier.Load(); notifier != nil {
+			notifier.wrote()
+		}
+	}
+	return present
+}
+
+func (this *Mmap) Add(bytes []byte) {
+	this.TestAndAdd(bytes)
+}
+
+func (this *Mmap) AddString(str string) {
+	this.Add([]byte(str))
+}
+
+func (this *Mmap) Test(bytes []byte) bool {
+	h := baseHashes(this.hasher, bytes)
+	if !this.rlock() {
+		return false
+	}
+	defer this.mutex.RUnlock()
+	return this.test(h)
+}
+
+func (this *Mmap) TestString(str string) bool {
+	return this.Test([]byte(str))
+}
+
+// TestAndAdd is the equivalent to calling Test(data) then Add(data).
+// Returns the result of Test.
+func (this *Mmap) TestAndAdd(data []byte) bool {
+	h := baseHashes(this.hasher, data)
+	if !this.rlock() {
+		return false
+	}
+	defer this.mutex.RUnlock()
+	return this.testAndAdd(h)
+}
+
+// TestAndAddString is the equivalent to calling Test(string) then Add(string).
+// Returns the result of Test.
+func (this *Mmap) TestAndAddString(data string) bool {
+	return this.TestAndAdd([]byte(data))
+}
+
+// TestOrAdd is the equivalent to calling Test(data) then if not present Add(data).
+// Setting the bits of a present item changes nothing, so it is the same as TestAndAdd.
+// Returns the result of Test.
+func (this *Mmap) TestOrAdd(data []byte) bool {
+	return this.TestAndAdd(data)
+}
+
+// TestOrAddString is the equivalent to calling Test(string) then if not present Add(string).
+// Returns the result of Test.
+func (this *Mmap) TestOrAddString(data string) bool {
+	return this.TestOrAdd([]byte(data))
+}
+
+// AddMany is the equivalent to calling Add for every item.
+func (this *Mmap) AddMany(items [][]byte) {
+	this.TestOrAddMany(items)
+}
+
+// TestMany is the equivalent to calling Test for every item, under a single lock.
+func (this *Mmap) TestMany(items [][]byte) []bool {
+	hashes := baseHashesMany(this.hasher, items)
+	results := make([]bool, len(items))
+	if !this.rlock() {
+		return results
+	}
+	defer this.mutex.RUnlock()
+	for i, h := range hashes {
+		results[i] = this.test(h)
+	}
+	return results
+}
+
+// TestOrAddMany is the equivalent to calling TestOrAdd for every item, under a single lock.
+func (this *Mmap) TestOrAddMany(items [][]byte) []bool {
+	hashes := baseHashesMany(this.hasher, items)
+	results := make([]bool, len(items))
+	if !this.rlock() {
+		return results
+	}
+	defer this.mutex.RUnlock()
+	for i, h := range hashes {
+		results[i] = this.testAndAdd(h)
+	}
+	return results
+}
+
+func (this *Mmap) Clear() {
+	if !this.rlock() {
+		return
+	}
+	this.mutex.RUnlock()
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for i := range this.words {
+		this.words[i] = 0
+	}
+	this.items.Store(0)
+}
+
+// Size returns the number of bits, the one of the file once it is mapped.
+func (this *Mmap) Size() uint {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	return this.size
+}
+
+func (this *Mmap) Count() uint {
+	if !this.rlock() {
+		return 0
+	}
+	defer this.mutex.RUnlock()
+	count := 0
+	for i := range this.words {
+		count += bits.OnesCount32(atomic.LoadUint32(&this.words[i]))
+	}
+	return uint(count)
+}
+
+func (this *Mmap) Load() {
+	if err := this.LoadE(); err != nil {
+		logs.WithError(err).WithField("filepath", this.filepath).Error("bloomfilter.drivers.Mmap.Load: failed to map the file")
+	}
+}
+
+func (this *Mmap) Save() {
+	if err := this.SaveE(); err != nil {
+		logs.WithError(err).WithField("filepath", this.filepath).Error("bloomfilter.drivers.Mmap.Save: failed to sync the file")
+	}
+}
+
+// LoadE maps the file, creating it when it does not exist. It returns an error wrapping CorruptFileErr
+// when the file is not a mapped filter, nothing is changed in that case.
+func (this *Mmap) LoadE() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.words != nil {
+		return nil
+	}
+	return this.open()
+}
+
+// SaveE writes the number of items to the header and waits until the dirty pages are written to the file.
+func (this *Mmap) SaveE() error {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	if this.words == nil {
+		return nil
+	}
+	if notifier := this.notifier.Load(); notifier != nil {
+		notifier.writes.Store(0)
+	}
+	return this.sync()
+}
+
+// sync writes the header and the dirty pages, the caller must hold the lock.
+func (this *Mmap) sync() error {
+	this.saveMutex.Lock()
+	defer this.saveMutex.Unlock()
+	copy(this.data, encodeMmapHeader(this.header()))
+	if err := msync(this.data); err != nil {
+		return fmt.Errorf("%s: %w", this.filepath, err)
+	}
+	return nil
+}
+
+// Close saves and unmaps the file, the filter maps it again when it is used after.
+func (this *Mmap) Close() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.words == nil {
+		return nil
+	}
+	err := this.sync()
+	if unmapErr := munmap(this.data); err == nil {
+		err = unmapErr
+	}
+	if closeErr := this.file.Close(); err == nil {
+		err = closeErr
+	}
+	this.file, this.data, this.words = nil, nil, nil
+	return err
+}
@@ -0,0 +1,21 @@
+//go:build !(linux || darwin || freebsd)
+
+package drivers
+
+import (
+	"os"
+)
+
+const mmapSupported = false
+
+func mmap(file *os.File, size int) ([]byte, error) {
+	return nil, MmapUnsupportedErr
+}
+
+func munmap(data []byte) error {
+	return MmapUnsupportedErr
+}
+
+func msync(data []byte) error {
+	return MmapUnsupportedErr
+}
@@ -0,0 +1,29 @@
+//go:build linux || darwin || freebsd
+
+package drivers
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const mmapSupported = true
+
+// mmap maps size bytes of file in shared read and write mode, pages are faulted in on first access.
+func mmap(file *os.File, size int) ([]byte, error) {
+	return syscall.Mmap(int(file.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+}
+
+func munmap(data []byte) error {
+	return syscall.Munmap(data)
+}
+
+// msync writes the dirty pages of the mapping to the file and waits for the writes to complete.
+func msync(data []byte) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_MSYNC, uintptr(unsafe.Pointer(&data[0])), uintptr(len(data)), syscall.MS_SYNC)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package drivers
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/goal-web/bloomfilter/hash"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/supports/logs"
+	"github.com/goal-web/supports/utils"
+	"math"
+)
+
+const (
+	DefaultItems uint    = 10000
+	DefaultFPR   float64 = 0.01
+)
+
+// legacyParams maps the keys of older configurations to the keys of Params, "k" and "K"
+// were always the false positive probability, not the number of hash functions.
+var legacyParams = []struct{ key, replacement string }{
+	{"size", "items"},
+	{"Len", "items"},
+	{"k", "fpr"},
+	{"K", "fpr"},
+}
+
+// Params are the sizing parameters shared by all drivers:
+//
+//	items:    the expected number of items, defaults to 10000
+//	fpr:      the target false positive probability in (0, 1), defaults to 0.01
+//	bits:     optional, the number of bits, overrides the estimate from items and fpr
+//	hashes:   optional, the number of hash functions, overrides the estimate
+//	hash:     the hash function, murmur3 (default), xxhash64, fnv1a or siphash
+//	seed:     the seed of murmur3, xxhash64 and fnv1a
+//	hash_key: the secret key of siphash, 32 hex digits
+type Params struct {
+	Items  uint
+	FPR    float64
+	Bits   uint
+	Hashes uint
+	// Hasher is nil for the default murmur3 without seed.
+	Hasher hash.Hasher
+}
+
+// ParseParams reads and validates the sizing parameters of the filter name, a value out of range
+// returns a *ConfigError. Legacy keys are still read but a warning is logged.
+func ParseParams(name string, config contracts.Fields) (Params, error) {
+	config = migrateParams(name, config)
+	params := Params{Items: DefaultItems, FPR: DefaultFPR}
+
+	if _, exists := config["items"]; exists {
+		items := utils.GetInt64Field(config, "items")
+		if items <= 0 {
+			return params, &ConfigError{Filter: name, Field: "items", Err: fmt.Errorf("%w: %d, must be greater than 0", InvalidFieldErr, items)}
+		}
+		params.Items = uint(items)
+	}
+
+	if _, exists := config["fpr"]; exists {
+		params.FPR = utils.GetFloat64Field(config, "fpr")
+		if !(params.FPR > 0 && params.FPR < 1) {
+			return params, &ConfigError{Filter: name, Field: "fpr", Err: fmt.Errorf("%w: %v, must be between 0 and 1", InvalidFieldErr, params.FPR)}
+		}
+	}
+
+	for _, field := range []struct {
+		key   string
+		value *uint
+	}{{"bits", &params.Bits}, {"hashes", &params.Hashes}} {
+		if _, exists := config[field.key]; exists {
+			value := utils.GetInt64Field(config, field.key)
+			if value <= 0 {
+				return params, &ConfigError{Filter: name, Field: field.key, Err: fmt.Errorf("%w: %d", InvalidFieldErr, value)}
+			}
+			*field.value = uint(value)
+		}
+	}
+
+	return params, parseHasher(name, config, &params)
+}
+
+// parseHasher sets the hash function of params, the default one is left nil.
+func parseHasher(name string, config contracts.Fields, params *Params) error {
+	_, hasName := config["hash"]
+	_, hasSeed := config["seed"]
+	if !hasName && !hasSeed {
+		return nil
+	}
+	var key []byte
+	hashName := utils.GetStringField(config, "hash", "murmur3")
+	if hashName == "siphash" {
+		hashKey, err := requiredString(name, config, "hash_key")
+		if err != nil {
+			return err
+		}
+		if key, err = hex.DecodeString(hashKey); err != nil {
+			return &ConfigError{Filter: name, Field: "hash_key", Err: fmt.Errorf("%w: %v", InvalidFieldErr, err)}
+		}
+	}
+	hasher, err := hash.New(hashName, uint64(utils.GetInt64Field(config, "seed")), key)
+	if errors.Is(err, hash.InvalidKeyErr) {
+		return &ConfigError{Filter: name, Field: "hash_key", Err: err}
+	}
+	if err != nil {
+		return &ConfigError{Filter: name, Field: "hash", Err: err}
+	}
+	params.Hasher = hasher
+	return nil
+}
+
+// hasher returns the hash function of params.
+func (params Params) hasher() hash.Hasher {
+	return hasherOrDefault(params.Hasher)
+}
+
+// hasherOrDefault returns hasher, or murmur3 without seed when it is nil.
+func hasherOrDefault(hasher hash.Hasher) hash.Hasher {
+	if hasher == nil {
+		return defaultHasher
+	}
+	return hasher
+}
+
+var defaultHasher = hash.Murmur3(0)
+
+// migrateParams returns config with the legacy keys renamed, a key that is set in both forms keeps the new value.
+func migrateParams(name string, config contracts.Fields) contracts.Fields {
+	var migrated contracts.Fields
+	for _, legacy := range legacyParams {
+		value, exists := config[legacy.key]
+		if !exists {
+			continue
+		}
+		logs.WithField("name", name).WithField("key", legacy.key).
+			Warn(fmt.Sprintf("bloomfilter.drivers.ParseParams: legacy key, use %s instead", legacy.replacement))
+		if migrated == nil {
+			migrated = make(contracts.Fields, len(config))
+			utils.MergeFields(migrated, config)
+		}
+		if _, exists = config[legacy.replacement]; !exists {
+			migrated[legacy.replacement] = value
+		}
+	}
+	if migrated == nil {
+		return config
+	}
+	return migrated
+}
+
+// Estimate returns the number of bits m and of hash functions k, the explicit values
+// win over the estimate from Items and FPR.
+func (params Params) Estimate() (m uint, k uint) {
+	m, k = EstimateParameters(params.Items, params.FPR)
+	if params.Bits > 0 {
+		m = params.Bits
+		k = uint(math.Ceil(math.Log(2) * float64(m) / float64(params.Items)))
+	}
+	if params.Hashes > 0 {
+		k = params.Hashes
+	}
+	return Max(m, 1), Max(k, 1)
+}
+
+// sizedByItems returns a *ConfigError when bits or hashes are set, for drivers that size themselves
+// from Items and FPR only.
+func (params Params) sizedByItems(name string) error {
+	if params.Bits > 0 {
+		return &ConfigError{Filter: name, Field: "bits", Err: fmt.Errorf("%w: not supported by this driver", InvalidFieldErr)}
+	}
+	if params.Hashes > 0 {
+		return &ConfigError{Filter: name, Field: "hashes", Err: fmt.Errorf("%w: not supported by this driver", InvalidFieldErr)}
+	}
+	return nil
+}
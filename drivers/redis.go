@@ -1,22 +1,328 @@
 package drivers
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/goal-web/bloomfilter/hash"
 	"github.com/goal-web/contracts"
 	"github.com/goal-web/supports/logs"
+	"github.com/goal-web/supports/utils"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+func RedisDriver(redis contracts.RedisFactory) contracts.BloomFilterDriver {
+	return Must(RedisDriverE(redis))
+}
+
+// RedisDriverE is the equivalent to RedisDriver, but returns a *ConfigError instead of panicking.
+func RedisDriverE(redis contracts.RedisFactory) Driver {
+	return func(name string, config contracts.Fields) (contracts.BloomFilter, error) {
+		params, err := ParseParams(name, config)
+		if err != nil {
+			return nil, err
+		}
+		hashTag, err := redisHashTag(name, config)
+		if err != nil {
+			return nil, err
+		}
+		expire, err := redisExpire(name, config)
+		if err != nil {
+			return nil, err
+		}
+		onError, breaker, err := redisOnError(name, config)
+		if err != nil {
+			return nil, err
+		}
+		fallbackItems, fallbackFPR, err := redisFallback(name, config, params)
+		if err != nil {
+			return nil, err
+		}
+		size, k := params.Estimate()
+		return &Redis{
+			Len:         size,
+			K:           k,
+			Items:       params.Items,
+			FPR:         params.FPR,
+			Hasher:      params.Hasher,
+			Key:         redisKey(name, config),
+			SegmentBits: uint(utils.GetInt64Field(config, "segment_bits", 0)),
+			HashTag:     hashTag,
+			Expire:      expire,
+			Sliding:     utils.GetBoolField(config, "sliding"),
+			OnError:     onError,
+			Breaker:     breaker,
+			Fallback:    Params{Items: fallbackItems, FPR: fallbackFPR, Hasher: params.Hasher},
+			Redis:       redis.Connection(utils.GetStringField(config, "connection")),
+		}, nil
+	}
+}
+
+// redisExpire returns the "expire" field of config, "ttl" is accepted too. It returns a *ConfigError
+// when it is negative or shorter than a millisecond, the precision of redis.
+func redisExpire(name string, config contracts.Fields) (time.Duration, error) {
+	field := "expire"
+	if config[field] == nil && config["ttl"] != nil {
+		field = "ttl"
+	}
+	expire, err := durationField(name, config, field, 0)
+	if err == nil && expire != 0 && expire < time.Millisecond {
+		err = &ConfigError{Filter: name, Field: field, Err: fmt.Errorf("%w: %s, must be at least a millisecond", InvalidFieldErr, expire)}
+	}
+	return expire, err
+}
+
+// redisKey returns the configured key of the filter, "{name}" is replaced with the filter name.
+func redisKey(name string, config contracts.Fields) string {
+	return strings.ReplaceAll(utils.GetStringField(config, "key", fmt.Sprintf("bloomfilter:%s", name)), "{name}", name)
+}
+
+// redisHashTag returns the "hash_tag" field of config, or a *ConfigError when it is not "", "same" or "spread".
+func redisHashTag(name string, config contracts.Fields) (string, error) {
+	switch hashTag := utils.GetStringField(config, "hash_tag"); hashTag {
+	case "", "same", "spread":
+		return hashTag, nil
+	default:
+		return "", &ConfigError{Filter: name, Field: "hash_tag", Err: fmt.Errorf("%w: %s", InvalidFieldErr, hashTag)}
+	}
+}
+
+// redisMaxBits is the largest offset redis accepts in a single string (512MB).
+const redisMaxBits uint64 = 1 << 32
+
+// Redis is a bloom filter whose bits are stored in redis strings. Filters larger than
+// SegmentBits (at most 2^32 bits) are split across the keys "Key:0".."Key:N-1",
+// HashTag places the segments in the same ("same") or in different ("spread") cluster slots.
+// When Expire is set the keys expire together that long after their first write, or after the last one when Sliding is true,
+// when ExpiresAt is set they are deleted at that time instead.
+// OnError is the answer of Test when redis fails, see OnErrorAllow, and Breaker stops calling redis while it is down.
+// Fallback sizes the local filter of the fallback policy, see redisFallback.
 type Redis struct {
-	Len   uint
-	K     uint
-	Key   string
-	Redis contracts.RedisConnection
+	Len         uint
+	K           uint
+	Items       uint
+	FPR         float64
+	Hasher      hash.Hasher
+	Key         string
+	SegmentBits uint
+	HashTag     string
+	Expire      time.Duration
+	Sliding     bool
+	ExpiresAt   time.Time
+	OnError     string
+	Breaker     *Breaker
+	Fallback    Params
+	Redis       contracts.RedisConnection
+
+	// shadow records the adds of the process for the fallback policy.
+	shadowOnce sync.Once
+	shadow     *Memory
+	// deadline caches the time the segments in different slots expire at, in unix milliseconds, see expireSegments,
+	// and expired is the deadline once it is set on every segment.
+	deadline atomic.Int64
+	expired  atomic.Int64
 }
 
-func (this *Redis) Add(bytes []byte) {
-	h := baseHashes(bytes)
+// redisBatchSize is the number of items sent in a single lua script call by the batch methods.
+const redisBatchSize = 1000
+
+// redisBatch is a single lua script call, args holds (key index, offset) pairs.
+type redisBatch struct {
+	keys []string
+	args []interface{}
+}
+
+// hasher returns the hash function of the filter, murmur3 when Hasher is nil.
+func (this *Redis) hasher() hash.Hasher {
+	return hasherOrDefault(this.Hasher)
+}
+
+func (this *Redis) segmentBits() uint64 {
+	if this.SegmentBits == 0 || uint64(this.SegmentBits) > redisMaxBits {
+		return redisMaxBits
+	}
+	return uint64(this.SegmentBits)
+}
+
+func (this *Redis) segments() uint64 {
+	return (uint64(this.Len) + this.segmentBits() - 1) / this.segmentBits()
+}
+
+// segmentKey returns the key of the ith segment, a filter with a single segment uses Key itself.
+func (this *Redis) segmentKey(i uint64) string {
+	if this.segments() == 1 {
+		return this.Key
+	}
+	switch this.HashTag {
+	case "same":
+		return fmt.Sprintf("{%s}:%d", this.Key, i)
+	case "spread":
+		return fmt.Sprintf("%s:{%d}", this.Key, i)
+	}
+	return fmt.Sprintf("%s:%d", this.Key, i)
+}
+
+// keys returns the keys of all the segments.
+func (this *Redis) keys() []string {
+	keys := make([]string, this.segments())
+	for i := range keys {
+		keys[i] = this.segmentKey(uint64(i))
+	}
+	return keys
+}
+
+// sameSlot returns whether all the segments are guaranteed to be in the same cluster slot,
+// so that a single script can touch several of them.
+func (this *Redis) sameSlot() bool {
+	return this.segments() == 1 || this.HashTag == "same"
+}
+
+// newBatch returns a batch of a filter whose segments are in the same slot. The keys of a filter that expires
+// are all in the batch, so that the script sets their time to live together, see redisExpireLua.
+func (this *Redis) newBatch(keyIndexes map[uint64]int) *redisBatch {
+	batch := &redisBatch{}
+	if this.expires() {
+		batch.keys = this.keys()
+		for i := range batch.keys {
+			keyIndexes[uint64(i)] = i + 1
+		}
+	}
+	return batch
+}
+
+// batchOf routes the k offsets of every item to their segments in a single batch,
+// the first argument is k. It must only be used when sameSlot is true.
+func (this *Redis) batchOf(items [][]byte) *redisBatch {
+	keyIndexes := map[uint64]int{}
+	batch := this.newBatch(keyIndexes)
+	batch.args = make([]interface{}, 1, 1+2*len(items)*int(this.K))
+	batch.args[0] = this.K
+	for _, h := range baseHashesMany(this.hasher(), items) {
+		for i := uint(0); i < this.K; i++ {
+			l := uint64(this.location(h, i))
+			segment := l / this.segmentBits()
+			if _, exists := keyIndexes[segment]; !exists {
+				batch.keys = append(batch.keys, this.segmentKey(segment))
+				keyIndexes[segment] = len(batch.keys)
+			}
+			batch.args = append(batch.args, keyIndexes[segment], l%this.segmentBits())
+		}
+	}
+	return batch
+}
+
+// expires returns whether the keys of the filter are deleted after some time.
+func (this *Redis) expires() bool {
+	return this.Expire > 0 || !this.ExpiresAt.IsZero()
+}
+
+// expireArgs returns the arguments of the add scripts that set the time to live, see redisExpireLua.
+// The scripts can not reach the segments of other slots, they are expired by expireSegments instead.
+func (this *Redis) expireArgs() []interface{} {
+	switch {
+	case !this.sameSlot():
+		return []interface{}{0, 0}
+	case !this.ExpiresAt.IsZero():
+		return []interface{}{this.ExpiresAt.UnixMilli(), 2}
+	case this.Sliding:
+		return []interface{}{this.Expire.Milliseconds(), 1}
+	}
+	return []interface{}{this.Expire.Milliseconds(), 0}
+}
+
+// many runs the script for the items in chunks of redisBatchSize, one round trip per chunk, extra is appended
+// to the arguments of every call. The items of a chunk that fails are answered by the OnError policy,
+// local returns the answer of the fallback policy for the ith item. It must only be used when sameSlot is true.
+func (this *Redis) many(script *redisScript, items [][]byte, local func(int) bool, extra ...interface{}) []bool {
+	results := make([]bool, 0, len(items))
+	for start := 0; start < len(items); start += redisBatchSize {
+		end := start + redisBatchSize
+		if end > len(items) {
+			end = len(items)
+		}
+		batch := this.batchOf(items[start:end])
+		reply, err := this.run(context.Background(), script, batch.keys, append(batch.args, extra...)...)
+		if err != nil {
+			this.logError(err, "Redis.many: Failed to run script")
+			for i := start; i < end; i++ {
+				results = append(results, this.failed(local, i))
+			}
+			continue
+		}
+		values := toInt64s(reply)
+		for i := start; i < end; i++ {
+			results = append(results, i-start < len(values) && values[i-start] == 1)
+		}
+	}
+	return results
+}
+
+// AddMany is the equivalent to calling Add for every item.
+func (this *Redis) AddMany(items [][]byte) {
+	this.TestOrAddMany(items)
+}
+
+// TestMany is the equivalent to calling Test for every item, in one round trip per thousand items.
+func (this *Redis) TestMany(items [][]byte) []bool {
+	if !this.sameSlot() {
+		results := make([]bool, len(items))
+		for i, item := range items {
+			results[i] = this.test(item)
+		}
+		return results
+	}
+	return this.many(redisTestManyScript, items, func(i int) bool {
+		return this.shadowFilter().Test(items[i])
+	})
+}
+
+// TestOrAddMany is the equivalent to calling TestOrAdd for every item, in one round trip per thousand items.
+func (this *Redis) TestOrAddMany(items [][]byte) []bool {
+	if !this.sameSlot() {
+		results := make([]bool, len(items))
+		for i, item := range items {
+			results[i] = this.set(item)
+		}
+		return results
+	}
+	var local []bool
+	if shadow := this.shadowFilter(); shadow != nil {
+		local = shadow.TestOrAddMany(items)
+	}
+	return this.many(redisAddManyScript, items, func(i int) bool {
+		return local[i]
+	}, this.expireArgs()...)
+}
+
+// batches routes the k offsets of data to their segments. All the offsets go into one batch,
+// and therefore one atomic round trip, unless the segments may live in different cluster slots.
+func (this *Redis) batches(data []byte) []*redisBatch {
+	h := baseHashes(this.hasher(), data)
+	single := this.sameSlot()
+	batches := make([]*redisBatch, 0, 1)
+	keyIndexes := map[uint64]int{}
+	batchIndexes := map[uint64]int{}
+	if single {
+		batches = append(batches, this.newBatch(keyIndexes))
+	}
 	for i := uint(0); i < this.K; i++ {
-		this.set(this.location(h, i))
+		l := uint64(this.location(h, i))
+		segment := l / this.segmentBits()
+		if _, exists := keyIndexes[segment]; !exists {
+			if !single {
+				batches = append(batches, &redisBatch{})
+			}
+			batch := batches[len(batches)-1]
+			batch.keys = append(batch.keys, this.segmentKey(segment))
+			keyIndexes[segment], batchIndexes[segment] = len(batch.keys), len(batches)-1
+		}
+		batch := batches[batchIndexes[segment]]
+		batch.args = append(batch.args, keyIndexes[segment], l%this.segmentBits())
 	}
+	return batches
 }
 
 // location returns the ith hashed location using the four base hash values
@@ -24,19 +330,186 @@ func (this *Redis) location(h [4]uint64, i uint) int64 {
 	return int64(location(h, i) % uint64(this.Len))
 }
 
-func (this *Redis) test(location int64) bool {
-	v, err := this.Redis.GetBit(this.Key, location)
-	if v == 0 || err != nil {
-		return false
+// run runs the script through the breaker, it fails with CircuitOpenErr while the breaker is open.
+func (this *Redis) run(ctx context.Context, script *redisScript, keys []string, args ...interface{}) (interface{}, error) {
+	var reply interface{}
+	err := this.call(func() (err error) {
+		reply, err = script.run(ctx, this.Redis, keys, args...)
+		return err
+	})
+	return reply, err
+}
+
+// call runs a redis command through the breaker, it fails with CircuitOpenErr while the breaker is open.
+func (this *Redis) call(command func() error) error {
+	allowed, probe := this.Breaker.allow()
+	if !allowed {
+		return CircuitOpenErr
+	}
+	err := command()
+	if this.Breaker.done(probe, err) {
+		logs.WithError(err).WithField("Key", this.Key).Error("Redis.call: circuit breaker opened")
+	}
+	return err
+}
+
+// logError logs the failure of a call, the calls failing while the breaker is open are not logged.
+func (this *Redis) logError(err error, msg string) {
+	if !errors.Is(err, CircuitOpenErr) {
+		logs.WithError(err).WithField("Key", this.Key).Error(msg)
+	}
+}
+
+// shadowFilter returns the local filter of the fallback policy, nil for the other policies.
+// It is sized by Fallback, or by the items and the false positive rate of the filter up to redisFallbackItems.
+func (this *Redis) shadowFilter() *Memory {
+	if this.OnError != OnErrorFallback {
+		return nil
+	}
+	this.shadowOnce.Do(func() {
+		params := this.Fallback
+		if params.Items == 0 {
+			params.Items, params.FPR, params.Hasher = this.Items, this.FPR, this.Hasher
+			if params.Items == 0 || params.Items > redisFallbackItems {
+				params.Items = redisFallbackItems
+			}
+		}
+		if params.FPR == 0 {
+			params.FPR = DefaultFPR
+		}
+		this.shadow = newMemory(this.Key, params)
+	})
+	return this.shadow
+}
+
+// failed returns the answer of the OnError policy, local returns the one of the fallback policy for the ith item.
+func (this *Redis) failed(local func(int) bool, i int) bool {
+	switch this.OnError {
+	case OnErrorDeny:
+		return true
+	case OnErrorFallback:
+		return local(i)
 	}
-	return true
+	return false
 }
 
-func (this *Redis) set(location int64) {
-	_, err := this.Redis.SetBit(this.Key, location, 1)
+// test checks all the bits of data, errors are logged and answered by the OnError policy.
+func (this *Redis) test(data []byte) bool {
+	present, err := this.testCtx(context.Background(), data)
 	if err != nil {
-		logs.WithError(err).WithField("Key", this.Key).Error("Redis.set: Failed to save bit")
+		this.logError(err, "Redis.test: Failed to get bits")
+		return this.failed(func(int) bool {
+			return this.shadowFilter().Test(data)
+		}, 0)
+	}
+	return present
+}
+
+// testCtx checks all the bits of data in a single round trip per batch.
+func (this *Redis) testCtx(ctx context.Context, data []byte) (bool, error) {
+	for _, batch := range this.batches(data) {
+		reply, err := this.run(ctx, redisTestScript, batch.keys, batch.args...)
+		if err != nil {
+			return false, fmt.Errorf("bloomfilter %s: %w", this.Key, err)
+		}
+		if toInt64(reply) != 1 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// set sets all the bits of data, errors are logged and answered by the OnError policy.
+func (this *Redis) set(data []byte) bool {
+	local := false
+	if shadow := this.shadowFilter(); shadow != nil {
+		local = shadow.TestAndAdd(data)
+	}
+	present, err := this.setCtx(context.Background(), data)
+	if err != nil {
+		this.logError(err, "Redis.set: Failed to save bits")
+		return this.failed(func(int) bool {
+			return local
+		}, 0)
+	}
+	return present
+}
+
+// setCtx sets all the bits of data atomically in a single round trip per batch,
+// it returns whether all of them were already set.
+func (this *Redis) setCtx(ctx context.Context, data []byte) (bool, error) {
+	present := true
+	for _, batch := range this.batches(data) {
+		reply, err := this.run(ctx, redisAddScript, batch.keys, append(batch.args, this.expireArgs()...)...)
+		if err != nil {
+			return false, fmt.Errorf("bloomfilter %s: %w", this.Key, err)
+		}
+		present = present && toInt64(reply) == 1
+	}
+	if err := this.expireSegments(ctx); err != nil {
+		return false, fmt.Errorf("bloomfilter %s: %w", this.Key, err)
+	}
+	return present, nil
+}
+
+// expireSegments sets the time to live of a filter whose segments are in different slots after a write, one call
+// per segment. They expire together at ExpiresAt or at the deadline set by the first write,
+// or Expire after the last one when Sliding is true.
+func (this *Redis) expireSegments(ctx context.Context) error {
+	if !this.expires() || this.sameSlot() {
+		return nil
+	}
+	deadline, fixed := time.Now().Add(this.Expire), !this.Sliding
+	if !this.ExpiresAt.IsZero() {
+		deadline, fixed = time.UnixMilli(this.ExpiresAt.UnixMilli()), true
+		if this.expired.Load() == deadline.UnixMilli() {
+			return nil
+		}
+	} else if !this.Sliding {
+		if cached := this.deadline.Load(); cached > time.Now().UnixMilli() {
+			// the segments created since keep the deadline of the first write, it is set on them once.
+			if this.expired.Load() == cached {
+				return nil
+			}
+			deadline = time.UnixMilli(cached)
+		} else {
+			// the segments written by another process keep their deadline.
+			ttl, err := this.TTL()
+			if err != nil {
+				return err
+			}
+			if ttl > 0 {
+				deadline = time.Now().Add(ttl)
+			}
+			deadline = time.UnixMilli(deadline.UnixMilli())
+			this.deadline.Store(deadline.UnixMilli())
+		}
+	}
+	all, err := this.expireAt(ctx, deadline)
+	if all && fixed {
+		this.expired.Store(deadline.UnixMilli())
+	}
+	return err
+}
+
+// AddCtx is the equivalent to Add, it honors the deadline of ctx and returns the errors of redis
+// instead of applying the OnError policy.
+func (this *Redis) AddCtx(ctx context.Context, bytes []byte) error {
+	if shadow := this.shadowFilter(); shadow != nil {
+		shadow.Add(bytes)
 	}
+	_, err := this.setCtx(ctx, bytes)
+	return err
+}
+
+// TestCtx is the equivalent to Test, it honors the deadline of ctx and returns the errors of redis
+// instead of applying the OnError policy.
+func (this *Redis) TestCtx(ctx context.Context, bytes []byte) (bool, error) {
+	return this.testCtx(ctx, bytes)
+}
+
+func (this *Redis) Add(bytes []byte) {
+	this.set(bytes)
 }
 
 func (this *Redis) AddString(str string) {
@@ -44,28 +517,13 @@ func (this *Redis) AddString(str string) {
 }
 
 func (this *Redis) Test(bytes []byte) bool {
-	h := baseHashes(bytes)
-	for i := uint(0); i < this.K; i++ {
-		if !this.test(this.location(h, i)) {
-			return false
-		}
-	}
-	return true
+	return this.test(bytes)
 }
 
 // TestAndAdd is the equivalent to calling Test(data) then Add(data).
 // Returns the result of Test.
 func (this *Redis) TestAndAdd(data []byte) bool {
-	present := true
-	h := baseHashes(data)
-	for i := uint(0); i < this.K; i++ {
-		l := this.location(h, i)
-		if !this.test(l) {
-			present = false
-		}
-		this.set(l)
-	}
-	return present
+	return this.set(data)
 }
 
 // TestAndAddString is the equivalent to calling Test(string) then Add(string).
@@ -75,18 +533,10 @@ func (this *Redis) TestAndAddString(data string) bool {
 }
 
 // TestOrAdd is the equivalent to calling Test(data) then if not present Add(data).
+// Setting the bits of a present item changes nothing, so it runs the same script as TestAndAdd.
 // Returns the result of Test.
 func (this *Redis) TestOrAdd(data []byte) bool {
-	present := true
-	h := baseHashes(data)
-	for i := uint(0); i < this.K; i++ {
-		l := this.location(h, i)
-		if !this.test(l) {
-			present = false
-			this.set(l)
-		}
-	}
-	return present
+	return this.set(data)
 }
 
 // TestOrAddString is the equivalent to calling Test(string) then if not present Add(string).
@@ -100,10 +550,82 @@ func (this *Redis) TestString(str string) bool {
 }
 
 func (this *Redis) Clear() {
-	_, err := this.Redis.Del(this.Key)
+	if shadow := this.shadowFilter(); shadow != nil {
+		shadow.Clear()
+	}
+	// a single DEL fails with CROSSSLOT in a cluster when the segments are in different slots.
+	deletes := [][]string{this.keys()}
+	if !this.sameSlot() {
+		deletes = deletes[:0]
+		for _, key := range this.keys() {
+			deletes = append(deletes, []string{key})
+		}
+	}
+	for _, keys := range deletes {
+		err := this.call(func() (err error) {
+			_, err = this.Redis.Del(keys...)
+			return err
+		})
+		if err != nil {
+			this.logError(err, "Redis.Clear: failed to delete")
+		}
+	}
+}
+
+// ExpireAt sets the time the keys of the filter are deleted at, keys that do not exist yet are not affected.
+func (this *Redis) ExpireAt(tm time.Time) error {
+	this.deadline.Store(tm.UnixMilli())
+	all, err := this.expireAt(context.Background(), tm)
 	if err != nil {
-		logs.WithError(err).WithField("Key", this.Key).Error("Redis.Clear: failed to delete")
+		return fmt.Errorf("bloomfilter %s: %w", this.Key, err)
+	}
+	if all {
+		this.expired.Store(tm.UnixMilli())
 	}
+	return nil
+}
+
+// expireAt sets the time the keys are deleted at, with a single script when they are in the same slot.
+// It returns whether every key exists and was set.
+func (this *Redis) expireAt(ctx context.Context, tm time.Time) (bool, error) {
+	keys := this.keys()
+	if this.sameSlot() {
+		reply, err := this.run(ctx, redisExpireAtScript, keys, tm.UnixMilli())
+		return toInt64(reply) == int64(len(keys)), err
+	}
+	all := true
+	for _, key := range keys {
+		var exists bool
+		err := this.call(func() (err error) {
+			exists, err = this.Redis.PExpireAtWithContext(ctx, key, tm)
+			return err
+		})
+		if err != nil {
+			return false, err
+		}
+		all = all && exists
+	}
+	return all, nil
+}
+
+// TTL returns the shortest time to live of the keys of the filter, as redis PTTL it is negative
+// when no key expires or no key exists.
+func (this *Redis) TTL() (time.Duration, error) {
+	ttl := time.Duration(-1)
+	for _, key := range this.keys() {
+		var keyTTL time.Duration
+		err := this.call(func() (err error) {
+			keyTTL, err = this.Redis.PTTL(key)
+			return err
+		})
+		if err != nil {
+			return 0, fmt.Errorf("bloomfilter %s: %w", this.Key, err)
+		}
+		if keyTTL >= 0 && (ttl < 0 || keyTTL < ttl) {
+			ttl = keyTTL
+		}
+	}
+	return ttl, nil
 }
 
 func (this *Redis) Size() uint {
@@ -111,11 +633,19 @@ func (this *Redis) Size() uint {
 }
 
 func (this *Redis) Count() uint {
-	count, _ := this.Redis.BitCount(this.Key, &contracts.BitCount{
-		Start: 0,
-		End:   int64(this.Len),
-	})
-	return uint(count)
+	count := uint(0)
+	for _, key := range this.keys() {
+		var bits int64
+		_ = this.call(func() (err error) {
+			bits, err = this.Redis.BitCount(key, &contracts.BitCount{
+				Start: 0,
+				End:   -1,
+			})
+			return err
+		})
+		count += uint(bits)
+	}
+	return count
 }
 
 func (this *Redis) Load() {
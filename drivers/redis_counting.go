@@ -0,0 +1,295 @@
+package drivers
+
+import (
+	"context"
+	"fmt"
+	"github.com/goal-web/bloomfilter/hash"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/supports/logs"
+)
+
+// RedisCounting is a counting bloom filter whose counters are stored in a redis string
+// and are accessed with BITFIELD, Width is the counter size in bits (4 or 8).
+type RedisCounting struct {
+	Len    uint
+	K      uint
+	Width  uint
+	Items  uint
+	FPR    float64
+	Hasher hash.Hasher
+	Key    string
+	Redis  contracts.RedisConnection
+}
+
+// hasher returns the hash function of the filter, murmur3 when Hasher is nil.
+func (this *RedisCounting) hasher() hash.Hasher {
+	return hasherOrDefault(this.Hasher)
+}
+
+// locations returns the counter indexes of data.
+func (this *RedisCounting) locations(data []byte) []uint {
+	h := baseHashes(this.hasher(), data)
+	locations := make([]uint, this.K)
+	for i := uint(0); i < this.K; i++ {
+		locations[i] = uint(location(h, i) % uint64(this.Len))
+	}
+	return locations
+}
+
+func (this *RedisCounting) encoding() string {
+	return fmt.Sprintf("u%d", this.Width)
+}
+
+// bitfield runs a single BITFIELD command made of the given operation for every location.
+func (this *RedisCounting) bitfield(ctx context.Context, locations []uint, operation ...interface{}) ([]int64, error) {
+	args := []interface{}{this.Key, "OVERFLOW", "SAT"}
+	for _, l := range locations {
+		args = append(args, operation[0], this.encoding(), fmt.Sprintf("#%d", l))
+		args = append(args, operation[1:]...)
+	}
+	reply, err := this.Redis.CommandWithContext(ctx, "BITFIELD", args...)
+	if err != nil {
+		return nil, err
+	}
+	return toInt64s(reply), nil
+}
+
+// counters returns the counter values of data.
+func (this *RedisCounting) counters(data []byte) []int64 {
+	values, err := this.bitfield(context.Background(), this.locations(data), "GET")
+	if err != nil {
+		logs.WithError(err).WithField("Key", this.Key).Error("RedisCounting.counters: Failed to get counters")
+		return nil
+	}
+	return values
+}
+
+func (this *RedisCounting) increment(locations []uint) {
+	_, err := this.bitfield(context.Background(), locations, "INCRBY", 1)
+	if err != nil {
+		logs.WithError(err).WithField("Key", this.Key).Error("RedisCounting.increment: Failed to increment counters")
+	}
+}
+
+func (this *RedisCounting) Add(bytes []byte) {
+	this.increment(this.locations(bytes))
+}
+
+// AddCtx is the equivalent to Add, it honors the deadline of ctx and returns the errors of redis.
+func (this *RedisCounting) AddCtx(ctx context.Context, bytes []byte) error {
+	if _, err := this.bitfield(ctx, this.locations(bytes), "INCRBY", 1); err != nil {
+		return fmt.Errorf("bloomfilter %s: %w", this.Key, err)
+	}
+	return nil
+}
+
+// TestCtx is the equivalent to Test, it honors the deadline of ctx and returns the errors of redis.
+func (this *RedisCounting) TestCtx(ctx context.Context, bytes []byte) (bool, error) {
+	values, err := this.bitfield(ctx, this.locations(bytes), "GET")
+	if err != nil {
+		return false, fmt.Errorf("bloomfilter %s: %w", this.Key, err)
+	}
+	return allPositive(values), nil
+}
+
+func (this *RedisCounting) AddString(str string) {
+	this.Add([]byte(str))
+}
+
+func (this *RedisCounting) Test(bytes []byte) bool {
+	return allPositive(this.counters(bytes))
+}
+
+func (this *RedisCounting) TestString(str string) bool {
+	return this.Test([]byte(str))
+}
+
+// TestAndAdd is the equivalent to calling Test(data) then Add(data).
+// Returns the result of Test.
+func (this *RedisCounting) TestAndAdd(data []byte) bool {
+	locations := this.locations(data)
+	args := []interface{}{this.Key, "OVERFLOW", "SAT"}
+	for _, l := range locations {
+		offset := fmt.Sprintf("#%d", l)
+		args = append(args, "GET", this.encoding(), offset, "INCRBY", this.encoding(), offset, 1)
+	}
+	reply, err := this.Redis.Command("BITFIELD", args...)
+	if err != nil {
+		logs.WithError(err).WithField("Key", this.Key).Error("RedisCounting.TestAndAdd: Failed to increment counters")
+		return false
+	}
+	values := toInt64s(reply)
+	present := len(values) == 2*len(locations)
+	for i := 0; present && i < len(values); i += 2 {
+		present = values[i] > 0
+	}
+	return present
+}
+
+// TestAndAddString is the equivalent to calling Test(string) then Add(string).
+// Returns the result of Test.
+func (this *RedisCounting) TestAndAddString(data string) bool {
+	return this.TestAndAdd([]byte(data))
+}
+
+// TestOrAdd is the equivalent to calling Test(data) then if not present Add(data), in a single script
+// so that an item is not added twice by concurrent calls.
+// Returns the result of Test.
+func (this *RedisCounting) TestOrAdd(data []byte) bool {
+	args := []interface{}{this.encoding()}
+	for _, l := range this.locations(data) {
+		args = append(args, fmt.Sprintf("#%d", l))
+	}
+	reply, err := redisCountingTestOrAddScript.run(context.Background(), this.Redis, []string{this.Key}, args...)
+	if err != nil {
+		logs.WithError(err).WithField("Key", this.Key).Error("RedisCounting.TestOrAdd: Failed to increment counters")
+		return false
+	}
+	return toInt64(reply) == 1
+}
+
+// TestOrAddString is the equivalent to calling Test(string) then if not present Add(string).
+// Returns the result of Test.
+func (this *RedisCounting) TestOrAddString(data string) bool {
+	return this.TestOrAdd([]byte(data))
+}
+
+// locationsMany returns the counter indexes of all the items, k per item.
+func (this *RedisCounting) locationsMany(items [][]byte) []uint {
+	locations := make([]uint, 0, len(items)*int(this.K))
+	for _, item := range items {
+		locations = append(locations, this.locations(item)...)
+	}
+	return locations
+}
+
+// AddMany increments the counters of all the items in a single BITFIELD round trip.
+func (this *RedisCounting) AddMany(items [][]byte) {
+	if len(items) > 0 {
+		this.increment(this.locationsMany(items))
+	}
+}
+
+// TestMany tests all the items in a single BITFIELD round trip.
+func (this *RedisCounting) TestMany(items [][]byte) []bool {
+	results := make([]bool, len(items))
+	if len(items) == 0 {
+		return results
+	}
+	values, err := this.bitfield(context.Background(), this.locationsMany(items), "GET")
+	if err != nil {
+		logs.WithError(err).WithField("Key", this.Key).Error("RedisCounting.TestMany: Failed to get counters")
+		return results
+	}
+	k := int(this.K)
+	for i := range items {
+		results[i] = len(values) >= (i+1)*k && allPositive(values[i*k:(i+1)*k])
+	}
+	return results
+}
+
+// TestOrAddMany tests all the items then increments the counters of the missing ones,
+// in two round trips. An item that appears twice is only added once.
+func (this *RedisCounting) TestOrAddMany(items [][]byte) []bool {
+	results := this.TestMany(items)
+	missing := make([][]byte, 0, len(items))
+	added := map[string]bool{}
+	for i, item := range items {
+		if results[i] {
+			continue
+		}
+		if added[string(item)] {
+			results[i] = true
+			continue
+		}
+		added[string(item)] = true
+		missing = append(missing, item)
+	}
+	this.AddMany(missing)
+	return results
+}
+
+// Remove decrements the counters of data, it does nothing if data is not present.
+// Saturated counters are left untouched. The counters are tested and decremented by a single script.
+func (this *RedisCounting) Remove(data []byte) {
+	args := []interface{}{this.encoding(), int64(1)<<this.Width - 1}
+	for _, l := range this.locations(data) {
+		args = append(args, fmt.Sprintf("#%d", l))
+	}
+	if _, err := redisCountingRemoveScript.run(context.Background(), this.Redis, []string{this.Key}, args...); err != nil {
+		logs.WithError(err).WithField("Key", this.Key).Error("RedisCounting.Remove: Failed to decrement counters")
+	}
+}
+
+// RemoveString is the equivalent to calling Remove([]byte(string)).
+func (this *RedisCounting) RemoveString(data string) {
+	this.Remove([]byte(data))
+}
+
+func (this *RedisCounting) Clear() {
+	_, err := this.Redis.Del(this.Key)
+	if err != nil {
+		logs.WithError(err).WithField("Key", this.Key).Error("RedisCounting.Clear: failed to delete")
+	}
+}
+
+func (this *RedisCounting) Size() uint {
+	return this.Len
+}
+
+// Count returns the number of non-zero counters.
+func (this *RedisCounting) Count() uint {
+	value, err := this.Redis.Get(this.Key)
+	if err != nil {
+		return 0
+	}
+	count := uint(0)
+	for _, b := range []byte(value) {
+		if this.Width == 8 {
+			if b > 0 {
+				count++
+			}
+			continue
+		}
+		if b&0xf0 > 0 {
+			count++
+		}
+		if b&0x0f > 0 {
+			count++
+		}
+	}
+	return count
+}
+
+func (this *RedisCounting) Load() {
+}
+
+func (this *RedisCounting) Save() {
+}
+
+// toInt64s converts a redis array reply to a slice of integers.
+func toInt64s(reply interface{}) []int64 {
+	items, _ := reply.([]interface{})
+	values := make([]int64, len(items))
+	for i, item := range items {
+		switch value := item.(type) {
+		case int64:
+			values[i] = value
+		case int:
+			values[i] = int64(value)
+		}
+	}
+	return values
+}
+
+func allPositive(values []int64) bool {
+	if len(values) == 0 {
+		return false
+	}
+	for _, value := range values {
+		if value <= 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,160 @@
+package drivers
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"github.com/goal-web/contracts"
+	"strings"
+)
+
+// redisScript is a lua script that is run with EVALSHA, falling back to EVAL
+// when the script is not cached by the server yet.
+type redisScript struct {
+	src string
+	sha string
+}
+
+func newRedisScript(src string) *redisScript {
+	sum := sha1.Sum([]byte(src))
+	return &redisScript{src: src, sha: hex.EncodeToString(sum[:])}
+}
+
+func (script *redisScript) run(ctx context.Context, redis contracts.RedisConnection, keys []string, args ...interface{}) (interface{}, error) {
+	reply, err := redis.EvalShaWithContext(ctx, script.sha, keys, args...)
+	if err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT") {
+		return redis.EvalWithContext(ctx, script.src, keys, args...)
+	}
+	return reply, err
+}
+
+var (
+	// redisTestScript returns 1 when every bit is set, ARGV holds (key index, offset) pairs.
+	redisTestScript = newRedisScript(`
+for i = 1, #ARGV, 2 do
+	if redis.call('GETBIT', KEYS[tonumber(ARGV[i])], ARGV[i + 1]) == 0 then
+		return 0
+	end
+end
+return 1`)
+
+	// redisAddScript sets every bit and returns 1 when all of them were already set,
+	// ARGV holds (key index, offset) pairs followed by the expiry, see redisExpireLua.
+	redisAddScript = newRedisScript(`
+local present = 1
+for i = 1, #ARGV - 2, 2 do
+	if redis.call('SETBIT', KEYS[tonumber(ARGV[i])], ARGV[i + 1], 1) == 0 then
+		present = 0
+	end
+end` + redisExpireLua + `
+return present`)
+
+	// redisTestManyScript tests many items and returns an array of 0/1, ARGV[1] is k
+	// and every item is followed by its k (key index, offset) pairs.
+	redisTestManyScript = newRedisScript(`
+local k = tonumber(ARGV[1])
+local results = {}
+for item = 0, (#ARGV - 1) / (2 * k) - 1 do
+	results[item + 1] = 1
+	for j = 0, k - 1 do
+		local i = 2 + 2 * (item * k + j)
+		if redis.call('GETBIT', KEYS[tonumber(ARGV[i])], ARGV[i + 1]) == 0 then
+			results[item + 1] = 0
+			break
+		end
+	end
+end
+return results`)
+
+	// redisAddManyScript adds many items and returns an array of 0/1 telling whether every item was present,
+	// the arguments are the same as redisTestManyScript followed by the expiry, see redisExpireLua.
+	redisAddManyScript = newRedisScript(`
+local k = tonumber(ARGV[1])
+local results = {}
+for item = 0, (#ARGV - 3) / (2 * k) - 1 do
+	results[item + 1] = 1
+	for j = 0, k - 1 do
+		local i = 2 + 2 * (item * k + j)
+		if redis.call('SETBIT', KEYS[tonumber(ARGV[i])], ARGV[i + 1], 1) == 0 then
+			results[item + 1] = 0
+		end
+	end
+end` + redisExpireLua + `
+return results`)
+
+	// redisCountingRemoveScript decrements the counters of an item when none of them is zero and returns 1 when it did,
+	// ARGV holds the counter encoding, the saturated value, which is left untouched, and the counter offsets.
+	redisCountingRemoveScript = newRedisScript(`
+local values = {}
+for i = 3, #ARGV do
+	values[i] = redis.call('BITFIELD', KEYS[1], 'GET', ARGV[1], ARGV[i])[1]
+	if values[i] == 0 then
+		return 0
+	end
+end
+for i = 3, #ARGV do
+	if values[i] < tonumber(ARGV[2]) then
+		redis.call('BITFIELD', KEYS[1], 'OVERFLOW', 'SAT', 'INCRBY', ARGV[1], ARGV[i], -1)
+	end
+end
+return 1`)
+
+	// redisCountingTestOrAddScript returns 1 when none of the counters of an item is zero, else it increments them and returns 0,
+	// ARGV holds the counter encoding and the counter offsets.
+	redisCountingTestOrAddScript = newRedisScript(`
+for i = 2, #ARGV do
+	if redis.call('BITFIELD', KEYS[1], 'GET', ARGV[1], ARGV[i])[1] == 0 then
+		for j = 2, #ARGV do
+			redis.call('BITFIELD', KEYS[1], 'OVERFLOW', 'SAT', 'INCRBY', ARGV[1], ARGV[j], 1)
+		end
+		return 0
+	end
+end
+return 1`)
+
+	// redisExpireAtScript sets the time every key is deleted at, ARGV[1] in unix milliseconds,
+	// and returns the number of keys that exist.
+	redisExpireAtScript = newRedisScript(`
+local set = 0
+for _, key in ipairs(KEYS) do
+	set = set + redis.call('PEXPIREAT', key, ARGV[1])
+end
+return set`)
+)
+
+// redisExpireLua sets the time to live of the keys of the add scripts, the last two arguments are the expiry and its mode:
+// with mode 0 the expiry is the time to live in milliseconds (0 to keep the keys forever) set by the first write, with 1 it is
+// refreshed on every write and with 2 it is the unix time in milliseconds the keys are deleted at. KEYS holds every segment
+// of the filter: the segments created by a write expire with the others, at the time set by the first write unless it is refreshed.
+const redisExpireLua = `
+local expire, mode = tonumber(ARGV[#ARGV - 1]), ARGV[#ARGV]
+if expire > 0 then
+	local command = 'PEXPIRE'
+	if mode == '2' then
+		command = 'PEXPIREAT'
+	elseif mode == '0' then
+		for _, key in ipairs(KEYS) do
+			local current = redis.call('PTTL', key)
+			if current > 0 then
+				expire = current
+				break
+			end
+		end
+	end
+	for _, key in ipairs(KEYS) do
+		if mode == '1' or redis.call('PTTL', key) == -1 then
+			redis.call(command, key, expire)
+		end
+	end
+end`
+
+// toInt64 converts a redis integer reply.
+func toInt64(reply interface{}) int64 {
+	switch value := reply.(type) {
+	case int64:
+		return value
+	case int:
+		return int64(value)
+	}
+	return 0
+}
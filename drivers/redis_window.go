@@ -0,0 +1,212 @@
+package drivers
+
+import (
+	"context"
+	"fmt"
+	"github.com/goal-web/bloomfilter/hash"
+	"github.com/goal-web/contracts"
+	"sync/atomic"
+	"time"
+)
+
+// RedisWindow is a time-windowed bloom filter whose generations are redis filters of Len bits
+// keyed "Key:<slice number>", see Window. The keys of a generation expire once it left the window,
+// the writes that create them set their TTL, see Redis.ExpiresAt.
+type RedisWindow struct {
+	Len         uint
+	K           uint
+	Items       uint
+	FPR         float64
+	Hasher      hash.Hasher
+	Key         string
+	SegmentBits uint
+	HashTag     string
+	Window      time.Duration
+	Generations uint
+	Redis       contracts.RedisConnection
+	// Now returns the current time, time.Now when nil.
+	Now func() time.Time
+
+	// current is the generation written to, kept so that its segments in different slots get their TTL once.
+	current atomic.Pointer[Redis]
+}
+
+func (this *RedisWindow) generations() int64 {
+	return int64(Max(this.Generations, 1))
+}
+
+func (this *RedisWindow) slice() time.Duration {
+	return this.Window / time.Duration(this.generations())
+}
+
+// epoch returns the number of the current slice.
+func (this *RedisWindow) epoch() int64 {
+	now := time.Now
+	if this.Now != nil {
+		now = this.Now
+	}
+	return now().UnixNano() / int64(this.slice())
+}
+
+// generation returns the filter of the slice epoch, its keys are deleted at the end of the window it belongs to.
+func (this *RedisWindow) generation(epoch int64) *Redis {
+	return &Redis{
+		Len:         this.Len,
+		K:           this.K,
+		Hasher:      this.Hasher,
+		Key:         fmt.Sprintf("%s:%d", this.Key, epoch),
+		SegmentBits: this.SegmentBits,
+		HashTag:     this.HashTag,
+		ExpiresAt:   time.Unix(0, (epoch+this.generations()+1)*int64(this.slice())),
+		Redis:       this.Redis,
+	}
+}
+
+// writing returns the generation of the slice epoch to write to.
+func (this *RedisWindow) writing(epoch int64) *Redis {
+	key := fmt.Sprintf("%s:%d", this.Key, epoch)
+	if current := this.current.Load(); current != nil && current.Key == key {
+		return current
+	}
+	current := this.generation(epoch)
+	this.current.Store(current)
+	return current
+}
+
+// testGenerations sets the results of the items that are not found yet from the generations of the window
+// of epoch, from the slice from to the oldest, in one round trip per generation.
+func (this *RedisWindow) testGenerations(epoch, from int64, items [][]byte, results []bool) []bool {
+	for generation := from; generation >= epoch-this.generations(); generation-- {
+		missing, indexes := make([][]byte, 0, len(items)), make([]int, 0, len(items))
+		for i, item := range items {
+			if !results[i] {
+				missing, indexes = append(missing, item), append(indexes, i)
+			}
+		}
+		if len(missing) == 0 {
+			break
+		}
+		for i, found := range this.generation(generation).TestMany(missing) {
+			results[indexes[i]] = found
+		}
+	}
+	return results
+}
+
+func (this *RedisWindow) Add(bytes []byte) {
+	this.writing(this.epoch()).Add(bytes)
+}
+
+// AddCtx is the equivalent to Add, it honors the deadline of ctx and returns the errors of redis.
+func (this *RedisWindow) AddCtx(ctx context.Context, bytes []byte) error {
+	_, err := this.writing(this.epoch()).setCtx(ctx, bytes)
+	return err
+}
+
+// TestCtx is the equivalent to Test, it honors the deadline of ctx and returns the errors of redis.
+func (this *RedisWindow) TestCtx(ctx context.Context, bytes []byte) (bool, error) {
+	epoch := this.epoch()
+	for generation := epoch; generation >= epoch-this.generations(); generation-- {
+		if present, err := this.generation(generation).testCtx(ctx, bytes); present || err != nil {
+			return present, err
+		}
+	}
+	return false, nil
+}
+
+func (this *RedisWindow) AddString(str string) {
+	this.Add([]byte(str))
+}
+
+// Test checks the generations from the current one to the oldest, in one round trip per generation checked.
+func (this *RedisWindow) Test(bytes []byte) bool {
+	epoch := this.epoch()
+	for generation := epoch; generation >= epoch-this.generations(); generation-- {
+		if this.generation(generation).Test(bytes) {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *RedisWindow) TestString(str string) bool {
+	return this.Test([]byte(str))
+}
+
+// TestAndAdd is the equivalent to calling Test(data) then Add(data).
+// Returns the result of Test.
+func (this *RedisWindow) TestAndAdd(data []byte) bool {
+	epoch := this.epoch()
+	present := this.writing(epoch).TestAndAdd(data)
+	for generation := epoch - 1; generation >= epoch-this.generations() && !present; generation-- {
+		present = this.generation(generation).Test(data)
+	}
+	return present
+}
+
+// TestAndAddString is the equivalent to calling Test(string) then Add(string).
+// Returns the result of Test.
+func (this *RedisWindow) TestAndAddString(data string) bool {
+	return this.TestAndAdd([]byte(data))
+}
+
+// TestOrAdd is the equivalent to calling Test(data) then if not present Add(data), except that an item
+// only found in an older generation is added to the current one too, so that it is remembered for another window.
+// Returns the result of Test.
+func (this *RedisWindow) TestOrAdd(data []byte) bool {
+	return this.TestAndAdd(data)
+}
+
+// TestOrAddString is the equivalent to calling Test(string) then if not present Add(string).
+// Returns the result of Test.
+func (this *RedisWindow) TestOrAddString(data string) bool {
+	return this.TestOrAdd([]byte(data))
+}
+
+// AddMany is the equivalent to calling Add for every item.
+func (this *RedisWindow) AddMany(items [][]byte) {
+	this.TestOrAddMany(items)
+}
+
+// TestMany is the equivalent to calling Test for every item.
+func (this *RedisWindow) TestMany(items [][]byte) []bool {
+	epoch := this.epoch()
+	return this.testGenerations(epoch, epoch, items, make([]bool, len(items)))
+}
+
+// TestOrAddMany is the equivalent to calling TestOrAdd for every item.
+func (this *RedisWindow) TestOrAddMany(items [][]byte) []bool {
+	epoch := this.epoch()
+	results := this.writing(epoch).TestOrAddMany(items)
+	return this.testGenerations(epoch, epoch-1, items, results)
+}
+
+// Clear deletes the keys of every generation in the window one generation at a time,
+// their keys are in different cluster slots, see Redis.Clear.
+func (this *RedisWindow) Clear() {
+	epoch := this.epoch()
+	for generation := epoch; generation >= epoch-this.generations(); generation-- {
+		this.generation(generation).Clear()
+	}
+}
+
+// Size returns the number of bits of the generations in the window.
+func (this *RedisWindow) Size() uint {
+	return this.Len * uint(this.generations()+1)
+}
+
+// Count returns the number of set bits of the generations in the window.
+func (this *RedisWindow) Count() uint {
+	epoch := this.epoch()
+	count := uint(0)
+	for generation := epoch; generation >= epoch-this.generations(); generation-- {
+		count += this.generation(generation).Count()
+	}
+	return count
+}
+
+func (this *RedisWindow) Load() {
+}
+
+func (this *RedisWindow) Save() {
+}
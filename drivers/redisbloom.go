@@ -0,0 +1,255 @@
+package drivers
+
+import (
+	"context"
+	"fmt"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/supports/logs"
+	"github.com/goal-web/supports/utils"
+	"strings"
+	"sync"
+)
+
+// RedisBloomDriver returns a driver of filters that delegate to the RedisBloom module,
+// "items" and "fpr" are the capacity and the error rate of BF.RESERVE, see Params.
+func RedisBloomDriver(redis contracts.RedisFactory) contracts.BloomFilterDriver {
+	return Must(RedisBloomDriverE(redis))
+}
+
+// RedisBloomDriverE is the equivalent to RedisBloomDriver, but returns an error instead of panicking.
+func RedisBloomDriverE(redis contracts.RedisFactory) Driver {
+	return func(name string, config contracts.Fields) (contracts.BloomFilter, error) {
+		params, err := ParseParams(name, config)
+		if err == nil {
+			err = params.sizedByItems(name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if params.Hasher != nil {
+			return nil, &ConfigError{Filter: name, Field: "hash", Err: fmt.Errorf("%w: items are hashed by the server", InvalidFieldErr)}
+		}
+		return &RedisBloom{
+			Items:     params.Items,
+			ErrorRate: params.FPR,
+			Key:       redisKey(name, config),
+			Redis:     redis.Connection(utils.GetStringField(config, "connection")),
+		}, nil
+	}
+}
+
+// RedisBloom is a bloom filter that is implemented by the RedisBloom module (BF.* commands),
+// hashing happens on the server.
+type RedisBloom struct {
+	Items     uint
+	ErrorRate float64
+	Key       string
+	Redis     contracts.RedisConnection
+
+	mutex    sync.Mutex
+	reserved bool
+}
+
+// reserve creates the filter with the configured capacity and error rate before it is first written,
+// otherwise BF.ADD would create it with the module defaults.
+func (this *RedisBloom) reserve() {
+	if err := this.reserveCtx(context.Background()); err != nil {
+		logs.WithError(err).WithField("Key", this.Key).Error("RedisBloom.reserve: Failed to reserve filter")
+	}
+}
+
+func (this *RedisBloom) reserveCtx(ctx context.Context) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.reserved {
+		return nil
+	}
+	_, err := this.Redis.CommandWithContext(ctx, "BF.RESERVE", this.Key, this.ErrorRate, this.Items)
+	if err != nil && !strings.Contains(err.Error(), "exists") {
+		return err
+	}
+	this.reserved = true
+	return nil
+}
+
+func (this *RedisBloom) Add(bytes []byte) {
+	this.TestAndAdd(bytes)
+}
+
+// AddCtx is the equivalent to Add, it honors the deadline of ctx and returns the errors of redis.
+func (this *RedisBloom) AddCtx(ctx context.Context, bytes []byte) error {
+	err := this.reserveCtx(ctx)
+	if err == nil {
+		_, err = this.Redis.CommandWithContext(ctx, "BF.ADD", this.Key, bytes)
+	}
+	if err != nil {
+		return fmt.Errorf("bloomfilter %s: %w", this.Key, err)
+	}
+	return nil
+}
+
+// TestCtx is the equivalent to Test, it honors the deadline of ctx and returns the errors of redis.
+func (this *RedisBloom) TestCtx(ctx context.Context, bytes []byte) (bool, error) {
+	reply, err := this.Redis.CommandWithContext(ctx, "BF.EXISTS", this.Key, bytes)
+	if err != nil {
+		return false, fmt.Errorf("bloomfilter %s: %w", this.Key, err)
+	}
+	return toInt64(reply) == 1, nil
+}
+
+func (this *RedisBloom) AddString(str string) {
+	this.Add([]byte(str))
+}
+
+func (this *RedisBloom) Test(bytes []byte) bool {
+	reply, err := this.Redis.Command("BF.EXISTS", this.Key, bytes)
+	if err != nil {
+		logs.WithError(err).WithField("Key", this.Key).Error("RedisBloom.Test: Failed to test item")
+		return false
+	}
+	return toInt64(reply) == 1
+}
+
+func (this *RedisBloom) TestString(str string) bool {
+	return this.Test([]byte(str))
+}
+
+// TestAndAdd is the equivalent to calling Test(data) then Add(data).
+// BF.ADD replies 0 when the item may have existed, so it takes a single atomic round trip.
+// Returns the result of Test.
+func (this *RedisBloom) TestAndAdd(data []byte) bool {
+	this.reserve()
+	reply, err := this.Redis.Command("BF.ADD", this.Key, data)
+	if err != nil {
+		logs.WithError(err).WithField("Key", this.Key).Error("RedisBloom.TestAndAdd: Failed to add item")
+		return false
+	}
+	return toInt64(reply) == 0
+}
+
+// TestAndAddString is the equivalent to calling Test(string) then Add(string).
+// Returns the result of Test.
+func (this *RedisBloom) TestAndAddString(data string) bool {
+	return this.TestAndAdd([]byte(data))
+}
+
+// TestOrAdd is the equivalent to calling Test(data) then if not present Add(data).
+// Returns the result of Test.
+func (this *RedisBloom) TestOrAdd(data []byte) bool {
+	return this.TestAndAdd(data)
+}
+
+// TestOrAddString is the equivalent to calling Test(string) then if not present Add(string).
+// Returns the result of Test.
+func (this *RedisBloom) TestOrAddString(data string) bool {
+	return this.TestOrAdd([]byte(data))
+}
+
+// TestMany tests all the items in a single BF.MEXISTS round trip.
+func (this *RedisBloom) TestMany(items [][]byte) []bool {
+	if len(items) == 0 {
+		return []bool{}
+	}
+	reply, err := this.Redis.Command("BF.MEXISTS", append([]interface{}{this.Key}, toArgs(items)...)...)
+	if err != nil {
+		logs.WithError(err).WithField("Key", this.Key).Error("RedisBloom.TestMany: Failed to test items")
+		return make([]bool, len(items))
+	}
+	results := make([]bool, len(items))
+	values := toInt64s(reply)
+	if len(values) != len(items) {
+		err = fmt.Errorf("BF.MEXISTS returned %d replies for %d items", len(values), len(items))
+		logs.WithError(err).WithField("Key", this.Key).Error("RedisBloom.TestMany: Unexpected reply")
+		return results
+	}
+	for i, value := range values {
+		results[i] = value == 1
+	}
+	return results
+}
+
+// TestOrAddMany adds all the items in a single BF.MADD round trip and returns
+// for every item whether it was present.
+func (this *RedisBloom) TestOrAddMany(items [][]byte) []bool {
+	if len(items) == 0 {
+		return []bool{}
+	}
+	this.reserve()
+	reply, err := this.Redis.Command("BF.MADD", append([]interface{}{this.Key}, toArgs(items)...)...)
+	if err != nil {
+		logs.WithError(err).WithField("Key", this.Key).Error("RedisBloom.TestOrAddMany: Failed to add items")
+		return make([]bool, len(items))
+	}
+	results := make([]bool, len(items))
+	values := toInt64s(reply)
+	if len(values) != len(items) {
+		err = fmt.Errorf("BF.MADD returned %d replies for %d items", len(values), len(items))
+		logs.WithError(err).WithField("Key", this.Key).Error("RedisBloom.TestOrAddMany: Unexpected reply")
+		return results
+	}
+	for i, value := range values {
+		results[i] = value == 0
+	}
+	return results
+}
+
+// AddMany adds all the items in a single BF.MADD round trip.
+func (this *RedisBloom) AddMany(items [][]byte) {
+	this.TestOrAddMany(items)
+}
+
+func (this *RedisBloom) Clear() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	_, err := this.Redis.Del(this.Key)
+	if err != nil {
+		logs.WithError(err).WithField("Key", this.Key).Error("RedisBloom.Clear: failed to delete")
+		return
+	}
+	this.reserved = false
+}
+
+// info returns the fields of BF.INFO.
+func (this *RedisBloom) info() map[string]int64 {
+	reply, err := this.Redis.Command("BF.INFO", this.Key)
+	if err != nil {
+		logs.WithError(err).WithField("Key", this.Key).Debug("RedisBloom.info: Failed to get info")
+		return nil
+	}
+	items, _ := reply.([]interface{})
+	info := make(map[string]int64, len(items)/2)
+	for i := 0; i+1 < len(items); i += 2 {
+		info[fmt.Sprintf("%s", items[i])] = toInt64(items[i+1])
+	}
+	return info
+}
+
+// Size returns the capacity of the filter.
+func (this *RedisBloom) Size() uint {
+	if capacity, exists := this.info()["Capacity"]; exists {
+		return uint(capacity)
+	}
+	return this.Items
+}
+
+// Count returns the number of items inserted.
+func (this *RedisBloom) Count() uint {
+	return uint(this.info()["Number of items inserted"])
+}
+
+// Load reserves the filter.
+func (this *RedisBloom) Load() {
+	this.reserve()
+}
+
+func (this *RedisBloom) Save() {
+}
+
+// toArgs converts items to command arguments.
+func toArgs(items [][]byte) []interface{} {
+	args := make([]interface{}, len(items))
+	for i, item := range items {
+		args[i] = item
+	}
+	return args
+}
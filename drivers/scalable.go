@@ -0,0 +1,337 @@
+package drivers
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/goal-web/bloomfilter/hash"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/supports/utils"
+	"io"
+	"math"
+	"sync"
+)
+
+// ScalableDriver creates a scalable bloom filter, the "storage" field selects
+// whether the chain is kept in memory (default) or persisted to "filepath".
+func ScalableDriver(name string, config contracts.Fields) contracts.BloomFilter {
+	return Must(ScalableDriverE)(name, config)
+}
+
+// ScalableDriverE is the equivalent to ScalableDriver, but returns a *ConfigError instead of panicking.
+func ScalableDriverE(name string, config contracts.Fields) (contracts.BloomFilter, error) {
+	params, err := ParseParams(name, config)
+	if err == nil {
+		err = params.sizedByItems(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ratio := utils.GetFloat64Field(config, "ratio", 0.9)
+	if !(ratio > 0 && ratio < 1) {
+		return nil, &ConfigError{Filter: name, Field: "ratio", Err: fmt.Errorf("%w: %v, must be between 0 and 1", InvalidFieldErr, ratio)}
+	}
+	scalable := newScalable(name, params, uint(utils.GetIntField(config, "growth", 2)), ratio)
+	return withFileStorage(name, config, scalable, func(path string) contracts.BloomFilter {
+		return &ScalableFile{Scalable: scalable, filepath: path}
+	})
+}
+
+// NewScalable creates a scalable bloom filter (Almeida et al.) whose first sub-filter holds n items,
+// every new sub-filter is growth times larger and has an error rate ratio times tighter,
+// so that the compound false positive probability stays below p.
+func NewScalable(name string, n uint, p float64, growth uint, ratio float64) *Scalable {
+	return newScalable(name, Params{Items: n, FPR: p}, growth, ratio)
+}
+
+// newScalable creates a scalable bloom filter whose first sub-filter is sized by params, see NewScalable.
+func newScalable(name string, params Params, growth uint, ratio float64) *Scalable {
+	scalable := &Scalable{
+		name:     name,
+		capacity: Max(params.Items, 1),
+		p:        params.FPR,
+		growth:   Max(growth, 1),
+		ratio:    ratio,
+		hasher:   params.hasher(),
+	}
+	scalable.grow()
+	return scalable
+}
+
+// Scalable is a chain of in-memory bloom filters, a new sub-filter is appended
+// every time the last one reaches its capacity. It is safe for concurrent use.
+type Scalable struct {
+	name     string
+	capacity uint
+	p        float64
+	growth   uint
+	ratio    float64
+	hasher   hash.Hasher
+
+	filters []*Memory
+	// counts holds the number of items added to every sub-filter.
+	counts []uint
+	mutex  sync.RWMutex
+}
+
+// capacityOf returns the number of items the ith sub-filter is sized for.
+func (this *Scalable) capacityOf(i int) uint {
+	return this.capacity * uint(math.Pow(float64(this.growth), float64(i)))
+}
+
+// grow appends a sub-filter with a larger capacity and a tighter error rate.
+func (this *Scalable) grow() {
+	i := len(this.filters)
+	p := this.p * (1 - this.ratio) * math.Pow(this.ratio, float64(i))
+	this.filters = append(this.filters, newMemory(this.name, Params{Items: this.capacityOf(i), FPR: p, Hasher: this.hasher}))
+	this.counts = append(this.counts, 0)
+}
+
+func (this *Scalable) Add(bytes []byte) {
+	this.TestOrAdd(bytes)
+}
+
+func (this *Scalable) AddString(str string) {
+	this.Add([]byte(str))
+}
+
+func (this *Scalable) Test(bytes []byte) bool {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	return this.test(bytes)
+}
+
+func (this *Scalable) test(bytes []byte) bool {
+	for i := len(this.filters) - 1; i >= 0; i-- {
+		if this.filters[i].Test(bytes) {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *Scalable) TestString(str string) bool {
+	return this.Test([]byte(str))
+}
+
+// TestAndAdd is the equivalent to calling Test(data) then Add(data).
+// Returns the result of Test.
+func (this *Scalable) TestAndAdd(data []byte) bool {
+	return this.TestOrAdd(data)
+}
+
+// TestAndAddString is the equivalent to calling Test(string) then Add(string).
+// Returns the result of Test.
+func (this *Scalable) TestAndAddString(data string) bool {
+	return this.TestAndAdd([]byte(data))
+}
+
+// TestOrAdd is the equivalent to calling Test(data) then if not present Add(data).
+// Returns the result of Test.
+func (this *Scalable) TestOrAdd(data []byte) bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.testOrAdd(data)
+}
+
+func (this *Scalable) testOrAdd(data []byte) bool {
+	if this.test(data) {
+		return true
+	}
+	last := len(this.filters) - 1
+	if this.counts[last] >= this.capacityOf(last) {
+		this.grow()
+		last++
+	}
+	this.filters[last].Add(data)
+	this.counts[last]++
+	return false
+}
+
+// TestOrAddString is the equivalent to calling Test(string) then if not present Add(string).
+// Returns the result of Test.
+func (this *Scalable) TestOrAddString(data string) bool {
+	return this.TestOrAdd([]byte(data))
+}
+
+// AddMany is the equivalent to calling Add for every item.
+func (this *Scalable) AddMany(items [][]byte) {
+	this.TestOrAddMany(items)
+}
+
+// TestMany is the equivalent to calling Test for every item, under a single lock.
+func (this *Scalable) TestMany(items [][]byte) []bool {
+	results := make([]bool, len(items))
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	for i, item := range items {
+		results[i] = this.test(item)
+	}
+	return results
+}
+
+// TestOrAddMany is the equivalent to calling TestOrAdd for every item, under a single lock.
+func (this *Scalable) TestOrAddMany(items [][]byte) []bool {
+	results := make([]bool, len(items))
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for i, item := range items {
+		results[i] = this.testOrAdd(item)
+	}
+	return results
+}
+
+// Clear drops every sub-filter but a new, empty first one.
+func (this *Scalable) Clear() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.filters, this.counts = nil, nil
+	this.grow()
+}
+
+func (this *Scalable) Size() uint {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	size := uint(0)
+	for _, filter := range this.filters {
+		size += filter.Size()
+	}
+	return size
+}
+
+func (this *Scalable) Count() uint {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	count := uint(0)
+	for _, filter := range this.filters {
+		count += filter.Count()
+	}
+	return count
+}
+
+func (this *Scalable) Load() {
+}
+
+func (this *Scalable) Save() {
+}
+
+// WriteTo writes a binary representation of the whole chain to an i/o stream:
+// a versioned header, the parameters and every sub-filter, and a CRC32C trailer.
+// It returns the number of bytes written.
+func (this *Scalable) WriteTo(stream io.Writer) (int64, error) {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	h := header{Type: filterTypeScalable, Hash: this.hasher.ID(), Seed: this.hasher.Seed()}
+	for i, filter := range this.filters {
+		h.M += uint64(filter.Size())
+		h.Count += uint64(this.counts[i])
+	}
+	return writeEnvelope(stream, h, this.writePayload)
+}
+
+// writePayload writes the parameters of the chain followed by the count and the content of every sub-filter.
+func (this *Scalable) writePayload(stream io.Writer) (int64, error) {
+	values := []uint64{
+		uint64(this.capacity),
+		math.Float64bits(this.p),
+		uint64(this.growth),
+		math.Float64bits(this.ratio),
+		uint64(len(this.filters)),
+	}
+	if err := binary.Write(stream, binary.BigEndian, values); err != nil {
+		return 0, err
+	}
+	written := int64(binary.Size(values))
+	for i, filter := range this.filters {
+		if err := binary.Write(stream, binary.BigEndian, uint64(this.counts[i])); err != nil {
+			return written, err
+		}
+		n, err := filter.WriteTo(stream)
+		written += n + int64(binary.Size(uint64(0)))
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// ReadFrom reads a binary representation of the chain (such as might
+// have been written by WriteTo()) from an i/o stream, the header and the checksum are verified.
+// It returns the number of bytes read.
+func (this *Scalable) ReadFrom(stream io.Reader) (int64, error) {
+	return readEnvelope(stream, filterTypeScalable, this.hasher, func(stream io.Reader) (int64, error) {
+		n, apply, err := this.readPayload(stream)
+		if err == nil {
+			apply()
+		}
+		return n, err
+	}, func(h header, stream io.Reader) (int64, func(), error) {
+		return this.readPayload(stream)
+	})
+}
+
+// readPayload reads what writePayload wrote, the returned function replaces the chain with it.
+func (this *Scalable) readPayload(stream io.Reader) (int64, func(), error) {
+	values := make([]uint64, 5)
+	if err := binary.Read(stream, binary.BigEndian, values); err != nil {
+		return 0, nil, err
+	}
+	read := int64(binary.Size(values))
+	if values[4] == 0 {
+		return 0, nil, io.ErrUnexpectedEOF
+	}
+	// the negated comparisons reject NaN too.
+	p, ratio := math.Float64frombits(values[1]), math.Float64frombits(values[3])
+	if values[0] == 0 || values[2] < 1 || !(p > 0 && p < 1) || !(ratio > 0 && ratio <= 1) {
+		return 0, nil, errors.New("invalid scalable filter header")
+	}
+	filters := make([]*Memory, 0, 1)
+	counts := make([]uint, 0, 1)
+	for i := uint64(0); i < values[4]; i++ {
+		var count uint64
+		if err := binary.Read(stream, binary.BigEndian, &count); err != nil {
+			return 0, nil, err
+		}
+		filter := &Memory{name: this.name, hasher: this.hasher}
+		n, err := filter.ReadFrom(stream)
+		if err != nil {
+			return 0, nil, err
+		}
+		filters, counts = append(filters, filter), append(counts, uint(count))
+		read += n + int64(binary.Size(count))
+	}
+	return read, func() {
+		this.mutex.Lock()
+		defer this.mutex.Unlock()
+		this.capacity = uint(values[0])
+		this.p = p
+		this.growth = uint(values[2])
+		this.ratio = ratio
+		this.filters, this.counts = filters, counts
+	}, nil
+}
+
+// ScalableFile is a scalable bloom filter whose chain is loaded from and saved to a file.
+type ScalableFile struct {
+	*Scalable
+
+	filepath string
+}
+
+func (this *ScalableFile) Load() {
+	loadFile(this.filepath, this)
+}
+
+func (this *ScalableFile) Save() {
+	saveFile(this.filepath, this)
+}
+
+// LoadE is the equivalent to Load, but returns the error instead of logging it.
+func (this *ScalableFile) LoadE() error {
+	return readFile(this.filepath, this)
+}
+
+// SaveE is the equivalent to Save, but returns the error instead of logging it.
+func (this *ScalableFile) SaveE() error {
+	return writeFile(this.filepath, this)
+}
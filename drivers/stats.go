@@ -0,0 +1,285 @@
+package drivers
+
+import (
+	"math"
+)
+
+// estimateItems returns the number of items that most likely set x of the m bits of a filter
+// with k hash functions (Swamidass & Baldi), a full filter is estimated as if one bit was still unset.
+func estimateItems(m, k, x uint) uint {
+	if m == 0 || k == 0 {
+		return 0
+	}
+	if x >= m {
+		x = m - 1
+	}
+	return uint(math.Round(-float64(m) / float64(k) * math.Log(1-float64(x)/float64(m))))
+}
+
+// currentFPR returns the false positive probability of a filter with k hash functions and x of m bits set.
+func currentFPR(m, k, x uint) float64 {
+	if m == 0 {
+		return 0
+	}
+	return math.Pow(float64(x)/float64(m), float64(k))
+}
+
+// EstimatedItems returns the approximate number of distinct items added, from the number of set bits.
+func (this *Memory) EstimatedItems() uint {
+	return estimateItems(this.Size(), this.hashes(), this.Count())
+}
+
+// CurrentFPR returns the false positive probability from the actual fill ratio.
+func (this *Memory) CurrentFPR() float64 {
+	return currentFPR(this.Size(), this.hashes(), this.Count())
+}
+
+// Capacity returns the configured number of items.
+func (this *Memory) Capacity() uint {
+	return this.capacity
+}
+
+// TargetFPR returns the configured false positive probability.
+func (this *Memory) TargetFPR() float64 {
+	return this.fpr
+}
+
+func (this *Memory) hashes() uint {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	return this.k
+}
+
+// EstimatedItems returns the approximate number of distinct items added, from the BITCOUNT of the segments.
+func (this *Redis) EstimatedItems() uint {
+	return estimateItems(this.Len, this.K, this.Count())
+}
+
+// CurrentFPR returns the false positive probability from the actual fill ratio.
+func (this *Redis) CurrentFPR() float64 {
+	return currentFPR(this.Len, this.K, this.Count())
+}
+
+// Capacity returns the configured number of items.
+func (this *Redis) Capacity() uint {
+	return this.Items
+}
+
+// TargetFPR returns the configured false positive probability.
+func (this *Redis) TargetFPR() float64 {
+	return this.FPR
+}
+
+// EstimatedItems returns the approximate number of distinct items in the filter, from the number of non-zero counters.
+func (this *Counting) EstimatedItems() uint {
+	return estimateItems(this.size, this.k, this.Count())
+}
+
+// CurrentFPR returns the false positive probability from the number of non-zero counters.
+func (this *Counting) CurrentFPR() float64 {
+	return currentFPR(this.size, this.k, this.Count())
+}
+
+// Capacity returns the configured number of items.
+func (this *Counting) Capacity() uint {
+	return this.capacity
+}
+
+// TargetFPR returns the configured false positive probability.
+func (this *Counting) TargetFPR() float64 {
+	return this.fpr
+}
+
+// EstimatedItems returns the approximate number of distinct items in the filter, from the number of non-zero counters.
+func (this *RedisCounting) EstimatedItems() uint {
+	return estimateItems(this.Len, this.K, this.Count())
+}
+
+// CurrentFPR returns the false positive probability from the number of non-zero counters.
+func (this *RedisCounting) CurrentFPR() float64 {
+	return currentFPR(this.Len, this.K, this.Count())
+}
+
+// Capacity returns the configured number of items.
+func (this *RedisCounting) Capacity() uint {
+	return this.Items
+}
+
+// TargetFPR returns the configured false positive probability.
+func (this *RedisCounting) TargetFPR() float64 {
+	return this.FPR
+}
+
+// EstimatedItems returns the sum of the estimates of the sub-filters.
+func (this *Scalable) EstimatedItems() uint {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	items := uint(0)
+	for _, filter := range this.filters {
+		items += filter.EstimatedItems()
+	}
+	return items
+}
+
+// CurrentFPR returns the probability that any of the sub-filters reports a false positive.
+func (this *Scalable) CurrentFPR() float64 {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	negative := 1.0
+	for _, filter := range this.filters {
+		negative *= 1 - filter.CurrentFPR()
+	}
+	return 1 - negative
+}
+
+// Capacity returns the number of items the current sub-filters are sized for, it grows with the filter.
+func (this *Scalable) Capacity() uint {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	capacity := uint(0)
+	for i := range this.filters {
+		capacity += this.capacityOf(i)
+	}
+	return capacity
+}
+
+// TargetFPR returns the configured compound false positive probability.
+func (this *Scalable) TargetFPR() float64 {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	return this.p
+}
+
+// EstimatedItems returns the number of stored fingerprints, which is exact but for duplicates.
+func (this *Cuckoo) EstimatedItems() uint {
+	return this.Count()
+}
+
+// CurrentFPR returns the probability that one of the fingerprints stored in the two buckets
+// of an item matches its fingerprint, from the actual load factor.
+func (this *Cuckoo) CurrentFPR() float64 {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	compared := 2 * float64(this.count) / float64(this.buckets)
+	return 1 - math.Pow(1-math.Pow(2, -float64(this.fingerprint)), compared)
+}
+
+// Capacity returns the configured number of items.
+func (this *Cuckoo) Capacity() uint {
+	return this.capacity
+}
+
+// TargetFPR returns the configured false positive probability.
+func (this *Cuckoo) TargetFPR() float64 {
+	return this.fpr
+}
+
+// EstimatedItems returns the number of items inserted reported by BF.INFO.
+func (this *RedisBloom) EstimatedItems() uint {
+	return this.Count()
+}
+
+// CurrentFPR returns the false positive probability of a filter sized by BF.RESERVE holding the items
+// inserted, the module does not report its fill ratio.
+func (this *RedisBloom) CurrentFPR() float64 {
+	m, k := EstimateParameters(this.Items, this.ErrorRate)
+	if m == 0 {
+		return 0
+	}
+	return math.Pow(1-math.Exp(-float64(k)*float64(this.Count())/float64(m)), float64(k))
+}
+
+// Capacity returns the configured number of items.
+func (this *RedisBloom) Capacity() uint {
+	return this.Items
+}
+
+// TargetFPR returns the configured false positive probability.
+func (this *RedisBloom) TargetFPR() float64 {
+	return this.ErrorRate
+}
+
+// EstimatedItems returns the sum of the estimates of the generations, an item added in several slices
+// is counted once for every generation.
+func (this *Window) EstimatedItems() uint {
+	items := uint(0)
+	for _, filter := range this.retained() {
+		items += filter.EstimatedItems()
+	}
+	return items
+}
+
+// CurrentFPR returns the probability that any of the generations reports a false positive.
+func (this *Window) CurrentFPR() float64 {
+	negative := 1.0
+	for _, filter := range this.retained() {
+		negative *= 1 - filter.CurrentFPR()
+	}
+	return 1 - negative
+}
+
+// Capacity returns the configured number of items, every generation is sized for it.
+func (this *Window) Capacity() uint {
+	return this.params.Items
+}
+
+// TargetFPR returns the configured false positive probability of the whole window.
+func (this *Window) TargetFPR() float64 {
+	return this.fpr
+}
+
+// EstimatedItems returns the sum of the estimates of the generations, from the BITCOUNT of their keys.
+func (this *RedisWindow) EstimatedItems() uint {
+	epoch := this.epoch()
+	items := uint(0)
+	for generation := epoch; generation >= epoch-this.generations(); generation-- {
+		items += this.generation(generation).EstimatedItems()
+	}
+	return items
+}
+
+// CurrentFPR returns the probability that any of the generations reports a false positive.
+func (this *RedisWindow) CurrentFPR() float64 {
+	epoch := this.epoch()
+	negative := 1.0
+	for generation := epoch; generation >= epoch-this.generations(); generation-- {
+		negative *= 1 - this.generation(generation).CurrentFPR()
+	}
+	return 1 - negative
+}
+
+// Capacity returns the configured number of items, every generation is sized for it.
+func (this *RedisWindow) Capacity() uint {
+	return this.Items
+}
+
+// TargetFPR returns the configured false positive probability of the whole window.
+func (this *RedisWindow) TargetFPR() float64 {
+	return this.FPR
+}
+
+// EstimatedItems returns the approximate number of distinct items added, from the number of set bits.
+func (this *Mmap) EstimatedItems() uint {
+	return estimateItems(this.Size(), this.hashes(), this.Count())
+}
+
+// CurrentFPR returns the false positive probability from the actual fill ratio.
+func (this *Mmap) CurrentFPR() float64 {
+	return currentFPR(this.Size(), this.hashes(), this.Count())
+}
+
+// Capacity returns the configured number of items.
+func (this *Mmap) Capacity() uint {
+	return this.capacity
+}
+
+// TargetFPR returns the configured false positive probability.
+func (this *Mmap) TargetFPR() float64 {
+	return this.fpr
+}
+
+func (this *Mmap) hashes() uint {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+	return this.k
+}
@@ -0,0 +1,332 @@
+package drivers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/goal-web/bloomfilter/hash"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/supports/logs"
+	"github.com/goal-web/supports/utils"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// walMagic starts every write-ahead log, it is followed by a header recording the hash function and a CRC32C.
+var walMagic = [4]byte{'G', 'W', 'W', 'L'}
+
+// kinds of the records of a write-ahead log.
+const (
+	walAdd uint8 = iota + 1
+	walClear
+)
+
+// walRecordSize is the size of a record: its kind, the base hashes of an item and a CRC32C of both.
+const walRecordSize = 1 + 4*8 + 4
+
+// sync policies of a write-ahead log, a positive interval syncs at most that often.
+const (
+	walSyncAlways time.Duration = 0
+	walSyncNever  time.Duration = -1
+)
+
+// ParseWal returns whether the "wal" field enables the write-ahead log and its "wal_sync" policy:
+// "always" (the default, 0) syncs before Add returns, "never" (-1) leaves it to the system and a duration,
+// such as "5ms" or a number of milliseconds, syncs the writes of that period at once.
+func ParseWal(name string, config contracts.Fields) (bool, time.Duration, error) {
+	if !utils.GetBoolField(config, "wal") {
+		return false, 0, nil
+	}
+	switch config["wal_sync"] {
+	case nil, "always":
+		return true, walSyncAlways, nil
+	case "never":
+		return true, walSyncNever, nil
+	}
+	interval, err := durationFieldIn(name, config, "wal_sync", walSyncAlways, time.Millisecond)
+	if err != nil {
+		return false, 0, err
+	}
+	if interval <= 0 {
+		return false, 0, &ConfigError{Filter: name, Field: "wal_sync", Err: fmt.Errorf("%w: %s", InvalidFieldErr, interval)}
+	}
+	return true, interval, nil
+}
+
+// walRecord is an add or a clear recorded by a write-ahead log.
+type walRecord struct {
+	kind   uint8
+	hashes [4]uint64
+}
+
+// wal is the append-only log of the writes of a file filter since its last save. Adds are recorded with the base
+// hashes of the items, so that replaying them does not depend on the size of the filter. Save renames the log to
+// path.old before writing the snapshot and deletes it after, Load replays path.old then path over the snapshot.
+type wal struct {
+	path     string
+	hasher   hash.Hasher
+	interval time.Duration
+
+	mutex sync.Mutex
+	file  *os.File
+	// pending holds the records of the group commit, appended and committed count the batches.
+	pending    []byte
+	appended   uint64
+	committed  uint64
+	committing bool
+	synced     *sync.Cond
+	timer      *time.Timer
+}
+
+func newWal(path string, hasher hash.Hasher, interval time.Duration) *wal {
+	log := &wal{path: path, hasher: hasher, interval: interval}
+	log.synced = sync.NewCond(&log.mutex)
+	return log
+}
+
+// append records the hashes, it returns once they are synced when the policy is always. The writers waiting
+// for a sync are committed together by the first of them. Errors are logged, the filter keeps working without the log.
+func (this *wal) append(kind uint8, hashes ...[4]uint64) {
+	records := make([]byte, 0, walRecordSize*len(hashes))
+	for _, h := range hashes {
+		records = appendWalRecord(records, walRecord{kind: kind, hashes: h})
+	}
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if err := this.open(nil); err != nil {
+		logs.WithError(err).WithField("filepath", this.path).Error("bloomfilter.drivers.wal.append: log open failed")
+		return
+	}
+	if this.interval != walSyncAlways {
+		if _, err := this.file.Write(records); err != nil {
+			logs.WithError(err).WithField("filepath", this.path).Error("bloomfilter.drivers.wal.append: log write failed")
+		}
+		if this.interval > 0 && this.timer == nil {
+			this.timer = time.AfterFunc(this.interval, this.sync)
+		}
+		return
+	}
+
+	this.pending = append(this.pending, records...)
+	this.appended++
+	for batch := this.appended; this.committed < batch; {
+		if this.committing {
+			this.synced.Wait()
+			continue
+		}
+		this.committing = true
+		file, pending, appended := this.file, this.pending, this.appended
+		this.pending = nil
+		this.mutex.Unlock()
+		_, err := file.Write(pending)
+		if err == nil {
+			err = file.Sync()
+		}
+		this.mutex.Lock()
+		this.committing, this.committed = false, appended
+		this.synced.Broadcast()
+		if err != nil {
+			logs.WithError(err).WithField("filepath", this.path).Error("bloomfilter.drivers.wal.append: log sync failed")
+		}
+	}
+}
+
+// sync syncs the writes of the last interval.
+func (this *wal) sync() {
+	this.mutex.Lock()
+	file := this.file
+	this.timer = nil
+	this.mutex.Unlock()
+	if file == nil {
+		return
+	}
+	// the log may be closed by a save meanwhile, it is synced before.
+	if err := file.Sync(); err != nil && !errors.Is(err, os.ErrClosed) {
+		logs.WithError(err).WithField("filepath", this.path).Error("bloomfilter.drivers.wal.sync: log sync failed")
+	}
+}
+
+// open opens the log for appending, apply is called with the records of an existing log,
+// a torn record left by a crash and the records after it are truncated. The caller must hold the mutex.
+func (this *wal) open(apply func(walRecord)) error {
+	if this.file != nil {
+		return nil
+	}
+	end, err := readWal(this.path, this.hasher, apply)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(this.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if err = file.Truncate(end); err == nil && end == 0 {
+		_, err = file.Write(encodeWalHeader(this.hasher))
+	}
+	if err == nil {
+		_, err = file.Seek(0, io.SeekEnd)
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+	this.file = file
+	return nil
+}
+
+// close syncs and closes the log, the caller must hold the mutex.
+func (this *wal) close() error {
+	if this.timer != nil {
+		this.timer.Stop()
+		this.timer = nil
+	}
+	for this.committing {
+		this.synced.Wait()
+	}
+	if this.file == nil {
+		return nil
+	}
+	err := this.file.Sync()
+	if closeErr := this.file.Close(); err == nil {
+		err = closeErr
+	}
+	this.file = nil
+	return err
+}
+
+// Close syncs and closes the log, it is opened again by the next append.
+func (this *wal) Close() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.close()
+}
+
+// replay returns the records of path.old then path, the log is opened for the next adds.
+func (this *wal) replay() ([]walRecord, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if err := this.close(); err != nil {
+		return nil, err
+	}
+	records := make([]walRecord, 0)
+	collect := func(record walRecord) {
+		records = append(records, record)
+	}
+	if _, err := readWal(this.path+".old", this.hasher, collect); err != nil {
+		return nil, err
+	}
+	if err := this.open(collect); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// rotate renames the log to path.old before a snapshot is written, the caller must hold the exclusive lock
+// of the filter so that no add is being recorded. A log left by a failed save is kept instead:
+// its records are older than the snapshot too.
+func (this *wal) rotate() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if _, err := os.Stat(this.path + ".old"); !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := this.close(); err != nil {
+		return err
+	}
+	if err := os.Rename(this.path, this.path+".old"); !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// compact deletes the records that are in the snapshot written since rotate.
+func (this *wal) compact() error {
+	if err := os.Remove(this.path + ".old"); !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// encodeWalHeader returns the magic number, the header recording the hash function and its CRC32C.
+func encodeWalHeader(hasher hash.Hasher) []byte {
+	var buffer bytes.Buffer
+	buffer.Write(walMagic[:])
+	_ = binary.Write(&buffer, binary.BigEndian, header{Version: formatVersion, Type: filterTypeBloom, Hash: hasher.ID(), Seed: hasher.Seed()})
+	return binary.BigEndian.AppendUint32(buffer.Bytes(), crc32.Checksum(buffer.Bytes(), crc32c))
+}
+
+func appendWalRecord(buffer []byte, record walRecord) []byte {
+	start := len(buffer)
+	buffer = append(buffer, record.kind)
+	for _, h := range record.hashes {
+		buffer = binary.BigEndian.AppendUint64(buffer, h)
+	}
+	return binary.BigEndian.AppendUint32(buffer, crc32.Checksum(buffer[start:], crc32c))
+}
+
+// readWal calls apply with the records of the log at path and returns the offset after the last complete one.
+// A missing or empty log has no records, a log written with another hash function returns an error
+// wrapping HasherMismatchErr and one that can not be decoded an error wrapping CorruptFileErr.
+func readWal(path string, hasher hash.Hasher, apply func(walRecord)) (int64, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	expected := encodeWalHeader(hasher)
+	current := make([]byte, len(expected))
+	if n, err := io.ReadFull(reader, current); err != nil {
+		if n > 0 && !bytes.Equal(current[:n], walMagic[:n]) {
+			return 0, &CorruptFileError{Path: path, Err: fmt.Errorf("%w: not a write-ahead log", UnsupportedFormatErr)}
+		}
+		// the log was created by a process that stopped before writing its header.
+		return 0, nil
+	}
+	if !bytes.Equal(current, expected) {
+		if !bytes.Equal(current[:len(walMagic)], walMagic[:]) {
+			return 0, &CorruptFileError{Path: path, Err: fmt.Errorf("%w: not a write-ahead log", UnsupportedFormatErr)}
+		}
+		end := len(current) - 4
+		if crc32.Checksum(current[:end], crc32c) != binary.BigEndian.Uint32(current[end:]) {
+			return 0, &CorruptFileError{Path: path, Err: ChecksumMismatchErr}
+		}
+		var h header
+		_ = binary.Read(bytes.NewReader(current[len(walMagic):end]), binary.BigEndian, &h)
+		if h.Version != formatVersion || h.Type != filterTypeBloom {
+			return 0, &CorruptFileError{Path: path, Err: fmt.Errorf("%w: version %d, filter type %d", UnsupportedFormatErr, h.Version, h.Type)}
+		}
+		return 0, fmt.Errorf("%s: %w: hash function %d (seed %d), filter uses %s", path, HasherMismatchErr, h.Hash, h.Seed, hasher.Name())
+	}
+
+	offset := int64(len(current))
+	record := make([]byte, walRecordSize)
+	for {
+		// a torn record is the last one, written when the process stopped.
+		if _, err = io.ReadFull(reader, record); err != nil {
+			return offset, nil
+		}
+		end := walRecordSize - 4
+		if crc32.Checksum(record[:end], crc32c) != binary.BigEndian.Uint32(record[end:]) {
+			return offset, nil
+		}
+		decoded := walRecord{kind: record[0]}
+		for i := range decoded.hashes {
+			decoded.hashes[i] = binary.BigEndian.Uint64(record[1+8*i:])
+		}
+		if apply != nil {
+			apply(decoded)
+		}
+		offset += walRecordSize
+	}
+}
@@ -0,0 +1,358 @@
+package drivers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/goal-web/bloomfilter/hash"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/supports/utils"
+	"io"
+	"sync"
+	"time"
+)
+
+// WindowDriver creates a time-windowed bloom filter that remembers items for the "window" field,
+// cut into "generations" slices (4 by default). The "storage" field selects whether the generations
+// are kept in memory (default), persisted to "filepath" or stored in redis keys that expire.
+func WindowDriver(redis contracts.RedisFactory) contracts.BloomFilterDriver {
+	return Must(WindowDriverE(redis))
+}
+
+// WindowDriverE is the equivalent to WindowDriver, but returns a *ConfigError instead of panicking.
+func WindowDriverE(redis contracts.RedisFactory) Driver {
+	return func(name string, config contracts.Fields) (contracts.BloomFilter, error) {
+		params, err := ParseParams(name, config)
+		if err != nil {
+			return nil, err
+		}
+		if config["window"] == nil {
+			return nil, &ConfigError{Filter: name, Field: "window", Err: MissingFieldErr}
+		}
+		window, err := durationField(name, config, "window", 0)
+		if err != nil {
+			return nil, err
+		}
+		generations := utils.GetIntField(config, "generations", 4)
+		if generations < 1 {
+			return nil, &ConfigError{Filter: name, Field: "generations", Err: fmt.Errorf("%w: %d, must be at least 1", InvalidFieldErr, generations)}
+		}
+		if window < time.Duration(generations)*time.Millisecond {
+			return nil, &ConfigError{Filter: name, Field: "window", Err: fmt.Errorf("%w: %s, must be at least a millisecond per generation", InvalidFieldErr, window)}
+		}
+		if utils.GetStringField(config, "storage") == "redis" {
+			hashTag, err := redisHashTag(name, config)
+			if err != nil {
+				return nil, err
+			}
+			size, k := generationParams(params, uint(generations)).Estimate()
+			return &RedisWindow{
+				Len:         size,
+				K:           k,
+				Items:       params.Items,
+				FPR:         params.FPR,
+				Hasher:      params.Hasher,
+				Key:         redisKey(name, config),
+				SegmentBits: uint(utils.GetInt64Field(config, "segment_bits", 0)),
+				HashTag:     hashTag,
+				Window:      window,
+				Generations: uint(generations),
+				Redis:       redis.Connection(utils.GetStringField(config, "connection")),
+				Now:         time.Now,
+			}, nil
+		}
+		filter := newWindow(name, params, window, uint(generations))
+		return withFileStorage(name, config, filter, func(path string) contracts.BloomFilter {
+			return &WindowFile{Window: filter, filepath: path}
+		})
+	}
+}
+
+// NewWindow creates an in-memory time-windowed bloom filter that remembers n items for window
+// with the false positive probability p, see Window.
+func NewWindow(name string, n uint, p float64, window time.Duration, generations uint) *Window {
+	return newWindow(name, Params{Items: n, FPR: p}, window, Max(generations, 1))
+}
+
+// newWindow creates a time-windowed bloom filter whose generations are sized by params.
+func newWindow(name string, params Params, window time.Duration, generations uint) *Window {
+	return &Window{
+		name:        name,
+		params:      generationParams(params, generations),
+		fpr:         params.FPR,
+		hasher:      params.hasher(),
+		slice:       window / time.Duration(generations),
+		generations: generations,
+		Now:         time.Now,
+	}
+}
+
+// generationParams sizes every generation of a window, Test checks generations+1 of them
+// so that each one gets that share of the false positive probability.
+func generationParams(params Params, generations uint) Params {
+	params.FPR /= float64(generations + 1)
+	return params
+}
+
+// Window is a time-windowed bloom filter. Time is cut into slices of window / generations, the items
+// are added to the generation of the current slice and Test checks it and the generations of the previous
+// slices, older generations are dropped. An item is remembered for at least window after it was last added
+// and forgotten at most one slice later. It is safe for concurrent use.
+type Window struct {
+	name   string
+	params Params
+	// fpr is the configured false positive probability of the whole window.
+	fpr         float64
+	hasher      hash.Hasher
+	slice       time.Duration
+	generations uint
+	// Now returns the current time, time.Now unless replaced before the filter is used.
+	Now func() time.Time
+
+	// filters are the retained generations from the oldest to the current one, epochs are their slice numbers.
+	filters []*Memory
+	epochs  []int64
+	mutex   sync.Mutex
+}
+
+// epoch returns the number of the current slice.
+func (this *Window) epoch() int64 {
+	return this.Now().UnixNano() / int64(this.slice)
+}
+
+// retained drops the generations that left the window and returns the others,
+// the last one is the generation of the current slice.
+func (this *Window) retained() []*Memory {
+	epoch := this.epoch()
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.rotate(epoch)
+	return append([]*Memory(nil), this.filters...)
+}
+
+// rotate drops the generations older than the window and appends the generation of epoch, the caller must hold the lock.
+func (this *Window) rotate(epoch int64) {
+	expired := 0
+	for expired < len(this.epochs) && this.epochs[expired] < epoch-int64(this.generations) {
+		expired++
+	}
+	this.filters, this.epochs = this.filters[expired:], this.epochs[expired:]
+	if len(this.epochs) == 0 || this.epochs[len(this.epochs)-1] < epoch {
+		this.filters = append(this.filters, newMemory(this.name, this.params))
+		this.epochs = append(this.epochs, epoch)
+	}
+}
+
+// testGenerations sets the results of the items that are not found yet from the generations.
+func testGenerations(filters []*Memory, items [][]byte, results []bool) []bool {
+	for _, filter := range filters {
+		for i, item := range items {
+			if !results[i] {
+				results[i] = filter.Test(item)
+			}
+		}
+	}
+	return results
+}
+
+func (this *Window) Add(bytes []byte) {
+	filters := this.retained()
+	filters[len(filters)-1].Add(bytes)
+}
+
+func (this *Window) AddString(str string) {
+	this.Add([]byte(str))
+}
+
+func (this *Window) Test(bytes []byte) bool {
+	filters := this.retained()
+	for i := len(filters) - 1; i >= 0; i-- {
+		if filters[i].Test(bytes) {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *Window) TestString(str string) bool {
+	return this.Test([]byte(str))
+}
+
+// TestAndAdd is the equivalent to calling Test(data) then Add(data).
+// Returns the result of Test.
+func (this *Window) TestAndAdd(data []byte) bool {
+	filters := this.retained()
+	last := len(filters) - 1
+	present := filters[last].TestAndAdd(data)
+	for i := last - 1; i >= 0 && !present; i-- {
+		present = filters[i].Test(data)
+	}
+	return present
+}
+
+// TestAndAddString is the equivalent to calling Test(string) then Add(string).
+// Returns the result of Test.
+func (this *Window) TestAndAddString(data string) bool {
+	return this.TestAndAdd([]byte(data))
+}
+
+// TestOrAdd is the equivalent to calling Test(data) then if not present Add(data), except that an item
+// only found in an older generation is added to the current one too, so that it is remembered for another window.
+// Returns the result of Test.
+func (this *Window) TestOrAdd(data []byte) bool {
+	return this.TestAndAdd(data)
+}
+
+// TestOrAddString is the equivalent to calling Test(string) then if not present Add(string).
+// Returns the result of Test.
+func (this *Window) TestOrAddString(data string) bool {
+	return this.TestOrAdd([]byte(data))
+}
+
+// AddMany is the equivalent to calling Add for every item.
+func (this *Window) AddMany(items [][]byte) {
+	filters := this.retained()
+	filters[len(filters)-1].AddMany(items)
+}
+
+// TestMany is the equivalent to calling Test for every item.
+func (this *Window) TestMany(items [][]byte) []bool {
+	return testGenerations(this.retained(), items, make([]bool, len(items)))
+}
+
+// TestOrAddMany is the equivalent to calling TestOrAdd for every item.
+func (this *Window) TestOrAddMany(items [][]byte) []bool {
+	filters := this.retained()
+	last := len(filters) - 1
+	return testGenerations(filters[:last], items, filters[last].TestOrAddMany(items))
+}
+
+// Clear drops every generation.
+func (this *Window) Clear() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.filters, this.epochs = nil, nil
+}
+
+// Size returns the number of bits of the retained generations.
+func (this *Window) Size() uint {
+	size := uint(0)
+	for _, filter := range this.retained() {
+		size += filter.Size()
+	}
+	return size
+}
+
+// Count returns the number of set bits of the retained generations.
+func (this *Window) Count() uint {
+	count := uint(0)
+	for _, filter := range this.retained() {
+		count += filter.Count()
+	}
+	return count
+}
+
+func (this *Window) Load() {
+}
+
+func (this *Window) Save() {
+}
+
+// WriteTo writes a binary representation of the retained generations to an i/o stream:
+// a versioned header, the start time and the content of every generation, and a CRC32C trailer.
+// It returns the number of bytes written.
+func (this *Window) WriteTo(stream io.Writer) (int64, error) {
+	epoch := this.epoch()
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.rotate(epoch)
+	h := header{Type: filterTypeWindow, Hash: this.hasher.ID(), Seed: this.hasher.Seed(), Count: uint64(len(this.filters))}
+	for _, filter := range this.filters {
+		h.M += uint64(filter.Size())
+	}
+	return writeEnvelope(stream, h, this.writePayload)
+}
+
+// writePayload writes the number of generations followed by the start time in nanoseconds and the content of every generation.
+func (this *Window) writePayload(stream io.Writer) (int64, error) {
+	if err := binary.Write(stream, binary.BigEndian, uint64(len(this.filters))); err != nil {
+		return 0, err
+	}
+	written := int64(binary.Size(uint64(0)))
+	for i, filter := range this.filters {
+		if err := binary.Write(stream, binary.BigEndian, this.epochs[i]*int64(this.slice)); err != nil {
+			return written, err
+		}
+		n, err := filter.WriteTo(stream)
+		written += n + int64(binary.Size(int64(0)))
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// ReadFrom reads a binary representation of the generations (such as might have been written by WriteTo())
+// from an i/o stream, the header and the checksum are verified. Generations are placed in the slices of their
+// start time, so that a file is still read after the window changed, and the ones that left the window are dropped.
+// It returns the number of bytes read.
+func (this *Window) ReadFrom(stream io.Reader) (int64, error) {
+	return readEnvelope(stream, filterTypeWindow, this.hasher, func(io.Reader) (int64, error) {
+		return 0, fmt.Errorf("%w: window filters have no legacy format", UnsupportedFormatErr)
+	}, this.readPayload)
+}
+
+// readPayload reads what writePayload wrote, the returned function replaces the generations with it.
+func (this *Window) readPayload(h header, stream io.Reader) (int64, func(), error) {
+	var count uint64
+	if err := binary.Read(stream, binary.BigEndian, &count); err != nil {
+		return 0, nil, err
+	}
+	read := int64(binary.Size(count))
+	filters := make([]*Memory, 0, this.generations+1)
+	epochs := make([]int64, 0, this.generations+1)
+	for i := uint64(0); i < count; i++ {
+		var start int64
+		if err := binary.Read(stream, binary.BigEndian, &start); err != nil {
+			return 0, nil, err
+		}
+		filter := newMemory(this.name, this.params)
+		n, err := filter.ReadFrom(stream)
+		if err != nil {
+			return 0, nil, err
+		}
+		filters, epochs = append(filters, filter), append(epochs, start/int64(this.slice))
+		read += n + int64(binary.Size(start))
+	}
+	return read, func() {
+		epoch := this.epoch()
+		this.mutex.Lock()
+		defer this.mutex.Unlock()
+		this.filters, this.epochs = filters, epochs
+		this.rotate(epoch)
+	}, nil
+}
+
+// WindowFile is a time-windowed bloom filter whose generations are loaded from and saved to a file.
+type WindowFile struct {
+	*Window
+
+	filepath string
+}
+
+func (this *WindowFile) Load() {
+	loadFile(this.filepath, this)
+}
+
+func (this *WindowFile) Save() {
+	saveFile(this.filepath, this)
+}
+
+// LoadE is the equivalent to Load, but returns the error instead of logging it.
+func (this *WindowFile) LoadE() error {
+	return readFile(this.filepath, this)
+}
+
+// SaveE is the equivalent to Save, but returns the error instead of logging it.
+func (this *WindowFile) SaveE() error {
+	return writeFile(this.filepath, this)
+}
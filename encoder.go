@@ -0,0 +1,168 @@
+package bloomfilter
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// Encoder converts keys of type T to the bytes that are added to a filter. Services that share a filter
+// must encode keys the same way, the name of the encoding is checked against the "encoding" field of the config.
+type Encoder[T any] interface {
+	// Name identifies the encoding, such as "int64".
+	Name() string
+	// Encode returns the bytes of key.
+	Encode(key T) []byte
+}
+
+// Integer is the set of integer types that IntEncoder accepts.
+type Integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+}
+
+// EncoderFunc returns a custom encoding named name.
+func EncoderFunc[T any](name string, encode func(key T) []byte) Encoder[T] {
+	return encoderFunc[T]{name: name, encode: encode}
+}
+
+type encoderFunc[T any] struct {
+	name   string
+	encode func(key T) []byte
+}
+
+func (encoder encoderFunc[T]) Name() string {
+	return encoder.name
+}
+
+func (encoder encoderFunc[T]) Encode(key T) []byte {
+	return encoder.encode(key)
+}
+
+// IntEncoder encodes integers as 8 bytes big endian, named "int64": an int32 and an int64 of the same value
+// give the same bytes, and negative values are encoded in two's complement.
+func IntEncoder[T Integer]() Encoder[T] {
+	return EncoderFunc("int64", func(key T) []byte {
+		return binary.BigEndian.AppendUint64(make([]byte, 0, 8), uint64(key))
+	})
+}
+
+// StringEncoder encodes strings as their UTF-8 bytes, named "string".
+func StringEncoder[T ~string]() Encoder[T] {
+	return EncoderFunc("string", func(key T) []byte {
+		return []byte(key)
+	})
+}
+
+// BytesEncoder uses byte slices as they are, named "bytes".
+func BytesEncoder[T ~[]byte]() Encoder[T] {
+	return EncoderFunc("bytes", func(key T) []byte {
+		return key
+	})
+}
+
+// UUIDEncoder encodes UUIDs as their 16 bytes, named "uuid". Any type defined as [16]byte is accepted,
+// such as the UUID types of the common uuid packages.
+func UUIDEncoder[T ~[16]byte]() Encoder[T] {
+	return EncoderFunc("uuid", func(key T) []byte {
+		bytes := [16]byte(key)
+		return bytes[:]
+	})
+}
+
+// UUIDStringEncoder encodes UUIDs in their text form as their 16 bytes, named "uuid" too so that it is
+// interchangeable with UUIDEncoder. The case and the dashes are ignored, text that is not a UUID is encoded
+// as it is.
+func UUIDStringEncoder[T ~string]() Encoder[T] {
+	return EncoderFunc("uuid", func(key T) []byte {
+		text := strings.TrimSuffix(strings.TrimPrefix(string(key), "{"), "}")
+		text = strings.TrimPrefix(strings.ToLower(text), "urn:uuid:")
+		bytes, err := hex.DecodeString(strings.ReplaceAll(text, "-", ""))
+		if err != nil || len(bytes) != 16 {
+			return []byte(key)
+		}
+		return bytes
+	})
+}
+
+// StructEncoder encodes composite keys field by field, in the order of declaration, named "struct".
+// Integers and floats take 8 bytes, booleans 1 byte, strings and byte slices are prefixed with their length
+// and byte arrays are used as they are. Unexported fields and fields tagged `bloom:"-"` are skipped.
+// It panics when T has a field of another kind, such as a pointer or a map.
+func StructEncoder[T any]() Encoder[T] {
+	if err := checkEncodable(reflect.TypeOf((*T)(nil)).Elem()); err != nil {
+		panic(err)
+	}
+	return EncoderFunc("struct", func(key T) []byte {
+		return appendValue(make([]byte, 0, 64), reflect.ValueOf(key))
+	})
+}
+
+// checkEncodable returns an error when values of t can not be encoded by appendValue.
+func checkEncodable(t reflect.Type) error {
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return nil
+		}
+		if t.Kind() == reflect.Array {
+			return checkEncodable(t.Elem())
+		}
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if field := t.Field(i); field.IsExported() && field.Tag.Get("bloom") != "-" {
+				if err := checkEncodable(field.Type); err != nil {
+					return fmt.Errorf("field %s: %w", field.Name, err)
+				}
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("bloomfilter: %s can not be encoded", t)
+}
+
+// appendValue appends the encoding of v to bytes, see StructEncoder.
+func appendValue(bytes []byte, v reflect.Value) []byte {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return append(bytes, 1)
+		}
+		return append(bytes, 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return binary.BigEndian.AppendUint64(bytes, uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return binary.BigEndian.AppendUint64(bytes, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return binary.BigEndian.AppendUint64(bytes, math.Float64bits(v.Float()))
+	case reflect.String:
+		bytes = binary.AppendUvarint(bytes, uint64(v.Len()))
+		return append(bytes, v.String()...)
+	case reflect.Slice:
+		bytes = binary.AppendUvarint(bytes, uint64(v.Len()))
+		return append(bytes, v.Bytes()...)
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if v.Type().Elem().Kind() == reflect.Uint8 {
+				bytes = append(bytes, byte(v.Index(i).Uint()))
+			} else {
+				bytes = appendValue(bytes, v.Index(i))
+			}
+		}
+		return bytes
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if field := v.Type().Field(i); field.IsExported() && field.Tag.Get("bloom") != "-" {
+				bytes = appendValue(bytes, v.Field(i))
+			}
+		}
+	}
+	return bytes
+}
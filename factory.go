@@ -5,87 +5,222 @@ import (
 	"fmt"
 	"github.com/goal-web/bloomfilter/drivers"
 	"github.com/goal-web/contracts"
-	"github.com/goal-web/supports/exceptions"
 	"github.com/goal-web/supports/logs"
 	"github.com/goal-web/supports/utils"
-	"strings"
+	"io"
 	"sync"
+	"time"
 )
 
 var DriverNotDefineErr = errors.New("driver not defined")
 var FilterNotDefineErr = errors.New("filter not defined")
+var CorruptFileErr = drivers.CorruptFileErr
+
+// ConfigError is returned by FilterE when a filter can not be created, it carries the filter name and the offending field.
+type ConfigError = drivers.ConfigError
 
 func NewFactory(config Config, redis contracts.RedisFactory) contracts.BloomFactory {
 	return &Factory{
-		drivers: map[string]contracts.BloomFilterDriver{
-			"file": drivers.FileDriver,
-			"redis": func(name string, config contracts.Fields) contracts.BloomFilter {
-				size, k := drivers.EstimateParameters(
-					uint(utils.GetIntField(config, "size", 10000)),
-					utils.GetFloat64Field(config, "k", 1),
-				)
-				return &drivers.Redis{
-					Len:   drivers.Max(size, 1),
-					K:     drivers.Max(k, 1),
-					Key:   strings.ReplaceAll(utils.GetStringField(config, "key", fmt.Sprintf("bloomfilter:%s", name)), "{name}", name),
-					Redis: redis.Connection(utils.GetStringField(config, "connection")),
-				}
-			},
+		drivers: map[string]drivers.Driver{
+			"file":       drivers.FileDriverE,
+			"memory":     drivers.MemoryDriverE,
+			"redis":      drivers.RedisDriverE(redis),
+			"counting":   drivers.CountingDriverE(redis),
+			"scalable":   drivers.ScalableDriverE,
+			"cuckoo":     drivers.CuckooDriverE,
+			"redisbloom": drivers.RedisBloomDriverE(redis),
+			"window":     drivers.WindowDriverE(redis),
+			"mmap":       drivers.MmapDriverE,
 		},
 		filters: sync.Map{},
 		config:  config,
+		stop:    make(chan struct{}),
 	}
 }
 
 type Factory struct {
-	drivers map[string]contracts.BloomFilterDriver
+	drivers map[string]drivers.Driver
 	filters sync.Map
 	config  Config
+	// stop is closed by Close to stop the autosave goroutines.
+	stop       chan struct{}
+	stopOnce   sync.Once
+	autosaving sync.WaitGroup
 }
 
+// Start loads every configured filter and starts saving the ones with the "autosave" or "autosave_writes"
+// fields in the background, a filter that can not be created or loaded is reported and skipped so that
+// the others keep working. It returns the first error.
 func (factory *Factory) Start() (err error) {
+	for name, _ := range factory.config.Filters {
+		filter, filterErr := factory.FilterE(name)
+		if filterErr != nil {
+			logs.WithError(filterErr).WithField("name", name).Error("bloomfilter.Factory.Start: ")
+			if err == nil {
+				err = filterErr
+			}
+			continue
+		}
+		// a corrupt file is reported, the filter starts empty.
+		if loadErr := factory.load(name, filter); loadErr != nil {
+			logs.WithError(loadErr).WithField("name", name).Error("bloomfilter.Factory.Start: ")
+			if err == nil {
+				err = fmt.Errorf("bloomfilter %s: %w", name, loadErr)
+			}
+		}
+		// the filter is saved only once it is loaded, so that the file is never overwritten by an empty filter.
+		if autosaveErr := factory.autosave(name, filter); autosaveErr != nil {
+			logs.WithError(autosaveErr).WithField("name", name).Error("bloomfilter.Factory.Start: ")
+			if err == nil {
+				err = autosaveErr
+			}
+		}
+	}
+	return
+}
+
+// load loads the filter, a driver panicking on what it reads returns a *drivers.CorruptFileError instead.
+func (factory *Factory) load(name string, filter contracts.BloomFilter) (err error) {
 	defer func() {
 		if panicValue := recover(); panicValue != nil {
-			err = exceptions.WithRecover(err, contracts.Fields{"config": factory.config})
+			path := utils.GetStringField(factory.config.Filters[name], "filepath")
+			err = &drivers.CorruptFileError{Path: path, Err: fmt.Errorf("load panicked: %v", panicValue)}
 		}
 	}()
+	if persistent, ok := filter.(PersistentFilter); ok {
+		return persistent.LoadE()
+	}
+	filter.Load()
+	return nil
+}
 
-	for name, _ := range factory.config.Filters {
-		factory.Filter(name).Load()
+// autosave starts a goroutine saving the filter every "autosave" interval and after "autosave_writes" writes,
+// writes are only counted by the filters that implement DirtyFilter. The goroutine stops with Close.
+func (factory *Factory) autosave(name string, filter contracts.BloomFilter) error {
+	interval, writes, err := drivers.ParseAutosave(name, factory.config.Filters[name])
+	if err != nil || (interval == 0 && writes == 0) {
+		return err
 	}
-	return
+
+	notify := make(chan struct{}, 1)
+	if writes > 0 {
+		dirty, ok := filter.(DirtyFilter)
+		if !ok {
+			logs.WithField("name", name).Warn("bloomfilter.Factory.autosave: the driver does not count writes, autosave_writes is ignored")
+		} else {
+			dirty.NotifyWrites(writes, notify)
+		}
+	}
+
+	factory.autosaving.Add(1)
+	go func() {
+		defer factory.autosaving.Done()
+		var tick <-chan time.Time
+		if interval > 0 {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for {
+			select {
+			case <-factory.stop:
+				return
+			case <-tick:
+			case <-notify:
+			}
+			factory.save(name, filter)
+		}
+	}()
+	return nil
 }
 
+// save saves the filter, the errors of a PersistentFilter are logged with the filter name.
+func (factory *Factory) save(name string, filter contracts.BloomFilter) {
+	persistent, ok := filter.(PersistentFilter)
+	if !ok {
+		filter.Save()
+		return
+	}
+	if err := persistent.SaveE(); err != nil {
+		logs.WithError(err).WithField("name", name).Error("bloomfilter.Factory.autosave: ")
+	}
+}
+
+// Close stops the autosave goroutines, then saves every filter that has been created and closes the ones
+// that implement io.Closer, such as the mmap driver, misconfigured filters are skipped.
 func (factory *Factory) Close() {
+	factory.stopOnce.Do(func() {
+		close(factory.stop)
+	})
+	factory.autosaving.Wait()
 	for name, _ := range factory.config.Filters {
-		factory.Filter(name).Save()
+		if filter, err := factory.FilterE(name); err == nil {
+			filter.Save()
+			if closer, ok := filter.(io.Closer); ok {
+				if err = closer.Close(); err != nil {
+					logs.WithError(err).WithField("name", name).Error("bloomfilter.Factory.Close: ")
+				}
+			}
+		}
 	}
 }
 
+// Extend registers a driver, a panic of the driver is returned by FilterE as a *ConfigError.
 func (factory *Factory) Extend(name string, driver contracts.BloomFilterDriver) {
+	factory.ExtendE(name, func(filter string, config contracts.Fields) (result contracts.BloomFilter, err error) {
+		defer func() {
+			if panicValue := recover(); panicValue != nil {
+				panicErr, ok := panicValue.(error)
+				if !ok {
+					panicErr = fmt.Errorf("%v", panicValue)
+				}
+				err = &ConfigError{Filter: filter, Err: panicErr}
+			}
+		}()
+		return driver(filter, config), nil
+	})
+}
+
+// ExtendE registers a driver that returns its errors.
+func (factory *Factory) ExtendE(name string, driver drivers.Driver) {
 	factory.drivers[name] = driver
 }
 
+// Filter returns the filter by name, it panics when the filter can not be created, see FilterE.
 func (factory *Factory) Filter(name string) contracts.BloomFilter {
+	filter, err := factory.FilterE(name)
+	if err != nil {
+		logs.WithError(err).WithField("name", name).Error("bloomfilter.Factory.Filter: ")
+		panic(err)
+	}
+	return filter
+}
+
+// FilterE is the equivalent to Filter, but returns a *ConfigError instead of panicking,
+// it matches FilterNotDefineErr, DriverNotDefineErr or the error of the driver.
+func (factory *Factory) FilterE(name string) (contracts.BloomFilter, error) {
 	value, ok := factory.filters.Load(name)
 	if ok {
-		return value.(contracts.BloomFilter)
+		return value.(contracts.BloomFilter), nil
 	}
 
 	config := factory.config.Filters[name]
 	if config == nil {
-		logs.WithError(FilterNotDefineErr).WithField("name", name).Error("bloomfilter.Factory.Filter: ")
-		panic(FilterNotDefineErr)
+		return nil, &ConfigError{Filter: name, Err: FilterNotDefineErr}
+	}
+
+	driver := factory.drivers[utils.GetStringField(config, "driver")]
+	if driver == nil {
+		return nil, &ConfigError{Filter: name, Field: "driver", Err: DriverNotDefineErr}
 	}
 
-	driver := utils.GetStringField(config, "driver")
-	if factory.drivers[driver] == nil {
-		logs.WithError(DriverNotDefineErr).WithField("name", name).WithFields(config).Error("bloomfilter.Factory.Filter: ")
-		panic(DriverNotDefineErr)
+	filter, err := driver(name, config)
+	if err != nil {
+		return nil, err
 	}
 
-	var filter = factory.drivers[driver](name, config)
-	factory.filters.Store(name, filter)
+	// concurrent callers may race to create the filter, all of them get the one stored first.
+	value, _ = factory.filters.LoadOrStore(name, filter)
 
-	return filter
+	return value.(contracts.BloomFilter), nil
 }
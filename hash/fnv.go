@@ -0,0 +1,37 @@
+package hash
+
+const (
+	fnvOffset64 uint64 = 14695981039346656037
+	fnvPrime64  uint64 = 1099511628211
+)
+
+// FNV1a returns the 64-bit FNV-1a hash function, seed is mixed into the offset basis
+// so that a zero seed is the standard FNV-1a.
+func FNV1a(seed uint64) Hasher {
+	return fnv1a{seed: seed}
+}
+
+type fnv1a struct {
+	seed uint64
+}
+
+func (fnv1a) Name() string {
+	return "fnv1a"
+}
+
+func (fnv1a) ID() uint8 {
+	return FNV1aID
+}
+
+func (h fnv1a) Seed() uint64 {
+	return h.seed
+}
+
+func (h fnv1a) Sum256(data []byte) (hash1, hash2, hash3, hash4 uint64) {
+	sum := fnvOffset64 ^ h.seed
+	for _, b := range data {
+		sum ^= uint64(b)
+		sum *= fnvPrime64
+	}
+	return expand(sum)
+}
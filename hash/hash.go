@@ -2,7 +2,6 @@ package hash
 
 import (
 	"math/bits"
-	"unsafe"
 )
 
 const (
@@ -21,8 +20,7 @@ type Digest128 struct {
 func (d *Digest128) bmix(p []byte) {
 	nblocks := len(p) / block_size
 	for i := 0; i < nblocks; i++ {
-		t := (*[2]uint64)(unsafe.Pointer(&p[i*block_size]))
-		k1, k2 := t[0], t[1]
+		k1, k2 := load64(p, i*block_size), load64(p, i*block_size+8)
 		d.bmixWords(k1, k2)
 	}
 }
@@ -216,8 +214,14 @@ func fmix64(k uint64) uint64 {
 //          v3, v4 := hasher.Sum128()
 // See TestHashRandom.
 func (d *Digest128) Sum256(data []byte) (hash1, hash2, hash3, hash4 uint64) {
-	// We always start from zero.
-	d.h1, d.h2 = 0, 0
+	return d.Sum256Seed(0, data)
+}
+
+// Sum256Seed is the equivalent to Sum256 with both halves of the state seeded by seed,
+// a zero seed gives the same hashes as Sum256.
+func (d *Digest128) Sum256Seed(seed uint64, data []byte) (hash1, hash2, hash3, hash4 uint64) {
+	// We always start from the seed.
+	d.h1, d.h2 = seed, seed
 	// Process as many bytes as possible.
 	d.bmix(data)
 	// We have enough to compute the first two 64-bit numbers
@@ -229,11 +233,10 @@ func (d *Digest128) Sum256(data []byte) (hash1, hash2, hash3, hash4 uint64) {
 	// we do not want to append to an actual array!!!
 	if tail_length+1 == block_size {
 		// We are left with no tail!!!
-		// Note that murmur3 is sensitive to endianess and so are we.
-		// We assume a little endian system. Go effectively never run
-		// on big endian systems so this is fine.
-		word1 := *(*uint64)(unsafe.Pointer(&tail[0]))
-		word2 := uint64(*(*uint32)(unsafe.Pointer(&tail[8])))
+		// Note that murmur3 is sensitive to endianess, words are always
+		// read as little endian so that every platform gives the same hashes.
+		word1 := load64(tail, 0)
+		word2 := uint64(load32(tail, 8))
 		word2 = word2 | (uint64(tail[12]) << 32) | (uint64(tail[13]) << 40) | (uint64(tail[14]) << 48)
 		// We append 1.
 		word2 = word2 | (uint64(1) << 56)
@@ -0,0 +1,93 @@
+package hash
+
+import (
+	"errors"
+	"fmt"
+)
+
+var UnknownHashErr = errors.New("unknown hash function")
+var InvalidKeyErr = errors.New("siphash key must be 16 bytes")
+
+// hash function ids, they are recorded in the files of the filters and must never change.
+const (
+	Murmur3ID uint8 = iota + 1
+	XXHash64ID
+	FNV1aID
+	SipHashID
+)
+
+// Hasher computes the four base hashes of an item, filters derive the locations of the item from them.
+// Implementations are safe for concurrent use.
+type Hasher interface {
+	// Name returns the name of the hash function, such as "murmur3".
+	Name() string
+	// ID identifies the hash function in persisted files.
+	ID() uint8
+	// Seed identifies the seed or the key of the hash function in persisted files, it never reveals a secret key.
+	Seed() uint64
+	// Sum256 returns four 64-bit hashes of data.
+	Sum256(data []byte) (hash1, hash2, hash3, hash4 uint64)
+}
+
+// New returns the hash function by name: murmur3, xxhash64 and fnv1a are seeded by seed,
+// siphash is keyed by the 16 bytes key.
+func New(name string, seed uint64, key []byte) (Hasher, error) {
+	switch name {
+	case "murmur3":
+		return Murmur3(seed), nil
+	case "xxhash64":
+		return XXHash64(seed), nil
+	case "fnv1a":
+		return FNV1a(seed), nil
+	case "siphash":
+		if len(key) != 16 {
+			return nil, InvalidKeyErr
+		}
+		var k [16]byte
+		copy(k[:], key)
+		return SipHash(k), nil
+	}
+	return nil, fmt.Errorf("%w: %s", UnknownHashErr, name)
+}
+
+// Murmur3 returns the 128-bit murmur3 hash function seeded by seed, it is the default of all the filters.
+func Murmur3(seed uint64) Hasher {
+	return murmur3{seed: seed}
+}
+
+type murmur3 struct {
+	seed uint64
+}
+
+func (murmur3) Name() string {
+	return "murmur3"
+}
+
+func (murmur3) ID() uint8 {
+	return Murmur3ID
+}
+
+func (h murmur3) Seed() uint64 {
+	return h.seed
+}
+
+func (h murmur3) Sum256(data []byte) (hash1, hash2, hash3, hash4 uint64) {
+	var d Digest128
+	return d.Sum256Seed(h.seed, data)
+}
+
+// expand derives four hashes from the 64-bit hash h with the splitmix64 generator,
+// so that 64-bit hash functions can locate items like murmur3 does.
+func expand(h uint64) (hash1, hash2, hash3, hash4 uint64) {
+	state := h
+	return h, splitmix64(&state), splitmix64(&state), splitmix64(&state)
+}
+
+// splitmix64 advances the state and returns its next output.
+func splitmix64(state *uint64) uint64 {
+	*state += 0x9e3779b97f4a7c15
+	z := *state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
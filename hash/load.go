@@ -0,0 +1,16 @@
+//go:build !(386 || amd64 || arm64 || ppc64le || riscv64 || loong64 || wasm) || purego
+
+package hash
+
+import "encoding/binary"
+
+// load64 reads the little endian word at b[i:], it is portable to big endian platforms
+// and to those that do not support unaligned loads.
+func load64(b []byte, i int) uint64 {
+	return binary.LittleEndian.Uint64(b[i:])
+}
+
+// load32 reads the little endian half word at b[i:].
+func load32(b []byte, i int) uint32 {
+	return binary.LittleEndian.Uint32(b[i:])
+}
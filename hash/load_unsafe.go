@@ -0,0 +1,18 @@
+//go:build (386 || amd64 || arm64 || ppc64le || riscv64 || loong64 || wasm) && !purego
+
+package hash
+
+import "unsafe"
+
+// load64 reads the little endian word at b[i:] with a single load, it is only built for
+// little endian platforms that support unaligned loads, see load.go for the portable version.
+func load64(b []byte, i int) uint64 {
+	_ = b[i+7]
+	return *(*uint64)(unsafe.Pointer(&b[i]))
+}
+
+// load32 reads the little endian half word at b[i:].
+func load32(b []byte, i int) uint32 {
+	_ = b[i+3]
+	return *(*uint32)(unsafe.Pointer(&b[i]))
+}
@@ -0,0 +1,90 @@
+package hash
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// sipHashKeyCheck is hashed with the key to identify it in persisted files without revealing it.
+var sipHashKeyCheck = []byte("goal-web/bloomfilter")
+
+// SipHash returns the SipHash-2-4 function keyed by key. Unlike the other hash functions it is a
+// keyed PRF: as long as the key is secret, inputs can not be crafted to collide and pollute a filter.
+func SipHash(key [16]byte) Hasher {
+	h := siphash{
+		k0: binary.LittleEndian.Uint64(key[:8]),
+		k1: binary.LittleEndian.Uint64(key[8:]),
+	}
+	h.check = Sum64Sip(h.k0, h.k1, sipHashKeyCheck)
+	return h
+}
+
+type siphash struct {
+	k0, k1 uint64
+	check  uint64
+}
+
+func (siphash) Name() string {
+	return "siphash"
+}
+
+func (siphash) ID() uint8 {
+	return SipHashID
+}
+
+// Seed returns a hash of a constant keyed by the key, so that files record which key they were built with.
+func (h siphash) Seed() uint64 {
+	return h.check
+}
+
+func (h siphash) Sum256(data []byte) (hash1, hash2, hash3, hash4 uint64) {
+	return expand(Sum64Sip(h.k0, h.k1, data))
+}
+
+// Sum64Sip returns the SipHash-2-4 of data keyed by k0 and k1, the two little endian halves of the key.
+func Sum64Sip(k0, k1 uint64, data []byte) uint64 {
+	v0 := k0 ^ 0x736f6d6570736575
+	v1 := k1 ^ 0x646f72616e646f6d
+	v2 := k0 ^ 0x6c7967656e657261
+	v3 := k1 ^ 0x7465646279746573
+
+	last := uint64(len(data)) << 56
+	for ; len(data) >= 8; data = data[8:] {
+		m := binary.LittleEndian.Uint64(data[:8])
+		v3 ^= m
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+		v0 ^= m
+	}
+	for i, b := range data {
+		last |= uint64(b) << (8 * uint(i))
+	}
+	v3 ^= last
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0 ^= last
+
+	v2 ^= 0xff
+	for i := 0; i < 4; i++ {
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	}
+	return v0 ^ v1 ^ v2 ^ v3
+}
+
+func sipRound(v0, v1, v2, v3 uint64) (uint64, uint64, uint64, uint64) {
+	v0 += v1
+	v1 = bits.RotateLeft64(v1, 13)
+	v1 ^= v0
+	v0 = bits.RotateLeft64(v0, 32)
+	v2 += v3
+	v3 = bits.RotateLeft64(v3, 16)
+	v3 ^= v2
+	v0 += v3
+	v3 = bits.RotateLeft64(v3, 21)
+	v3 ^= v0
+	v2 += v1
+	v1 = bits.RotateLeft64(v1, 17)
+	v1 ^= v2
+	v2 = bits.RotateLeft64(v2, 32)
+	return v0, v1, v2, v3
+}
@@ -0,0 +1,97 @@
+package hash
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+const (
+	prime64_1 uint64 = 11400714785074694791
+	prime64_2 uint64 = 14029467366897019727
+	prime64_3 uint64 = 1609587929392839161
+	prime64_4 uint64 = 9650029242287828579
+	prime64_5 uint64 = 2870177450012600261
+)
+
+// XXHash64 returns the 64-bit xxHash function seeded by seed.
+func XXHash64(seed uint64) Hasher {
+	return xxhash64{seed: seed}
+}
+
+type xxhash64 struct {
+	seed uint64
+}
+
+func (xxhash64) Name() string {
+	return "xxhash64"
+}
+
+func (xxhash64) ID() uint8 {
+	return XXHash64ID
+}
+
+func (h xxhash64) Seed() uint64 {
+	return h.seed
+}
+
+func (h xxhash64) Sum256(data []byte) (hash1, hash2, hash3, hash4 uint64) {
+	return expand(Sum64XX(h.seed, data))
+}
+
+// Sum64XX returns the xxHash64 of data seeded by seed.
+func Sum64XX(seed uint64, data []byte) uint64 {
+	length := uint64(len(data))
+	var h uint64
+	if len(data) >= 32 {
+		v1 := seed + prime64_1 + prime64_2
+		v2 := seed + prime64_2
+		v3 := seed
+		v4 := seed - prime64_1
+		for ; len(data) >= 32; data = data[32:] {
+			v1 = xxRound(v1, binary.LittleEndian.Uint64(data[0:8]))
+			v2 = xxRound(v2, binary.LittleEndian.Uint64(data[8:16]))
+			v3 = xxRound(v3, binary.LittleEndian.Uint64(data[16:24]))
+			v4 = xxRound(v4, binary.LittleEndian.Uint64(data[24:32]))
+		}
+		h = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) + bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		h = xxMergeRound(h, v1)
+		h = xxMergeRound(h, v2)
+		h = xxMergeRound(h, v3)
+		h = xxMergeRound(h, v4)
+	} else {
+		h = seed + prime64_5
+	}
+	h += length
+
+	for ; len(data) >= 8; data = data[8:] {
+		h ^= xxRound(0, binary.LittleEndian.Uint64(data[:8]))
+		h = bits.RotateLeft64(h, 27)*prime64_1 + prime64_4
+	}
+	if len(data) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(data[:4])) * prime64_1
+		h = bits.RotateLeft64(h, 23)*prime64_2 + prime64_3
+		data = data[4:]
+	}
+	for _, b := range data {
+		h ^= uint64(b) * prime64_5
+		h = bits.RotateLeft64(h, 11) * prime64_1
+	}
+
+	h ^= h >> 33
+	h *= prime64_2
+	h ^= h >> 29
+	h *= prime64_3
+	h ^= h >> 32
+	return h
+}
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * prime64_2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * prime64_1
+}
+
+func xxMergeRound(acc, value uint64) uint64 {
+	acc ^= xxRound(0, value)
+	return acc*prime64_1 + prime64_4
+}
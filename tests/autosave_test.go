@@ -0,0 +1,126 @@
+package tests
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/goal-web/bloomfilter"
+	"github.com/goal-web/bloomfilter/drivers"
+	"github.com/goal-web/contracts"
+	"github.com/stretchr/testify/assert"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// saved returns whether the file at path holds a filter that contains key.
+func saved(path string, key string) bool {
+	filter, _ := drivers.FileDriverE("saved", contracts.Fields{"filepath": path, "items": 100000, "fpr": 0.01})
+	return filter.(bloomfilter.PersistentFilter).LoadE() == nil && filter.TestString(key)
+}
+
+func TestAutosave(t *testing.T) {
+	var dir = t.TempDir()
+	var config = bloomfilter.Config{
+		Filters: bloomfilter.Filters{
+			"interval": contracts.Fields{"driver": "file", "items": 100000, "fpr": 0.01, "filepath": filepath.Join(dir, "interval"), "autosave": "10ms"},
+			"writes":   contracts.Fields{"driver": "file", "items": 100000, "fpr": 0.01, "filepath": filepath.Join(dir, "writes"), "autosave_writes": 10},
+		},
+	}
+	var factory = bloomfilter.NewFactory(config, nil)
+	assert.Nil(t, factory.Start())
+
+	factory.Filter("interval").AddString("goal")
+	assert.Eventually(t, func() bool { return saved(filepath.Join(dir, "interval"), "goal") }, time.Second, 5*time.Millisecond)
+
+	var filter = factory.Filter("writes")
+	for i := 0; i < 9; i++ {
+		filter.AddString(fmt.Sprintf("goal%d", i))
+	}
+	time.Sleep(20 * time.Millisecond)
+	_, err := os.Stat(filepath.Join(dir, "writes"))
+	assert.True(t, errors.Is(err, os.ErrNotExist), "nine writes do not save the filter")
+	filter.AddString("goal9")
+	assert.Eventually(t, func() bool { return saved(filepath.Join(dir, "writes"), "goal9") }, time.Second, 5*time.Millisecond)
+
+	// Close stops the goroutines before the last save.
+	factory.Close()
+	factory.Close()
+	filter.AddString("web")
+	time.Sleep(20 * time.Millisecond)
+	assert.False(t, saved(filepath.Join(dir, "interval"), "web") || saved(filepath.Join(dir, "writes"), "web"))
+}
+
+func TestAutosaveConfig(t *testing.T) {
+	var factory = bloomfilter.NewFactory(bloomfilter.Config{
+		Filters: bloomfilter.Filters{
+			"memory": contracts.Fields{"driver": "memory", "autosave_writes": -1},
+		},
+	}, nil)
+	var configErr *bloomfilter.ConfigError
+	assert.True(t, errors.As(factory.Start(), &configErr))
+	assert.Equal(t, "autosave_writes", configErr.Field)
+	factory.Close()
+}
+
+func TestDirtyPages(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "file")
+	var config = contracts.Fields{"filepath": path, "items": 100000, "fpr": 0.01}
+	filter, _ := drivers.FileDriverE("file", config)
+	var persistent = filter.(bloomfilter.PersistentFilter)
+	assert.Nil(t, persistent.SaveE())
+	before, _ := os.ReadFile(path)
+
+	// a single add changes at most k pages, the rest of the file is not written.
+	filter.AddString("goal")
+	assert.Nil(t, persistent.SaveE())
+	after, _ := os.ReadFile(path)
+	assert.Equal(t, len(before), len(after))
+	var pages = map[int]bool{}
+	for i := 4 + 40 + 8; i < len(after)-4; i++ {
+		if before[i] != after[i] {
+			pages[(i-4-40-8)/4096] = true
+		}
+	}
+	assert.NotEmpty(t, pages)
+	assert.LessOrEqual(t, len(pages), 7)
+	assert.True(t, saved(path, "goal"), "the checksum covers the pages written in place")
+
+	// a crash after the journal of the pages was written: they are written again by the next load.
+	_, err := os.Stat(path + ".pages")
+	assert.True(t, errors.Is(err, os.ErrNotExist), "the journal is removed once the pages are written")
+	var journal = append([]byte("GWPJ"), 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0)
+	journal = binary.BigEndian.AppendUint32(journal, uint32(len(after)))
+	journal = append(journal, after...)
+	journal = binary.BigEndian.AppendUint32(journal, crc32.Checksum(journal, crc32.MakeTable(crc32.Castagnoli)))
+	assert.Nil(t, os.WriteFile(path, before, 0644))
+	assert.Nil(t, os.WriteFile(path+".pages", journal, 0644))
+	assert.True(t, saved(path, "goal"))
+	_, err = os.Stat(path + ".pages")
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	// a crash while the journal was written: the file was not changed yet.
+	assert.Nil(t, os.WriteFile(path, before, 0644))
+	assert.Nil(t, os.WriteFile(path+".pages", journal[:len(journal)/2], 0644))
+	assert.False(t, saved(path, "goal"))
+	_, err = os.Stat(path + ".pages")
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	// a file whose checksum does not match is corrupt.
+	var corrupt = append([]byte{}, after...)
+	corrupt[len(corrupt)-1] ^= 0xff
+	assert.Nil(t, os.WriteFile(path, corrupt, 0644))
+	reloaded, _ := drivers.FileDriverE("file", config)
+	assert.True(t, errors.Is(reloaded.(bloomfilter.PersistentFilter).LoadE(), bloomfilter.CorruptFileErr))
+
+	// the file is rewritten in full when its layout is not the one of the filter.
+	other, _ := drivers.FileDriverE("file", contracts.Fields{"filepath": path, "items": 10, "fpr": 0.01})
+	other.AddString("web")
+	assert.Nil(t, other.(bloomfilter.PersistentFilter).SaveE())
+	other, _ = drivers.FileDriverE("file", contracts.Fields{"filepath": path, "items": 10, "fpr": 0.01})
+	assert.Nil(t, other.(bloomfilter.PersistentFilter).LoadE())
+	assert.True(t, other.TestString("web"))
+	assert.False(t, other.TestString("goal"))
+}
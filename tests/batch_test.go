@@ -0,0 +1,48 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/goal-web/bloomfilter"
+	"github.com/goal-web/contracts"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBatchFilters(t *testing.T) {
+	var factory = bloomfilter.NewFactory(bloomfilter.Config{
+		Filters: bloomfilter.Filters{
+			"memory":     contracts.Fields{"driver": "memory", "size": 1000, "k": 0.01},
+			"counting":   contracts.Fields{"driver": "counting", "size": 1000, "k": 0.01},
+			"scalable":   contracts.Fields{"driver": "scalable", "size": 100, "k": 0.01},
+			"cuckoo":     contracts.Fields{"driver": "cuckoo", "size": 1000, "k": 0.01},
+			"redisbloom": contracts.Fields{"driver": "redisbloom", "size": 1000, "k": 0.01},
+			"redis":      contracts.Fields{"driver": "redis", "size": 1000, "k": 0.01},
+			"window":     contracts.Fields{"driver": "window", "size": 1000, "k": 0.01, "window": "1h"},
+		},
+	}, newFakeRedis())
+
+	var items = make([][]byte, 0, 200)
+	for i := 0; i < 100; i++ {
+		items = append(items, []byte(fmt.Sprintf("goal%d", i)))
+	}
+	items = append(items, items[0])
+
+	for _, name := range []string{"memory", "counting", "scalable", "cuckoo", "redisbloom", "redis", "window"} {
+		var filter = factory.Filter(name)
+		assert.Implements(t, (*bloomfilter.BatchFilter)(nil), filter, name)
+
+		results := bloomfilter.TestOrAddMany(filter, items)
+		for i := 0; i < 100; i++ {
+			assert.False(t, results[i], name)
+		}
+		assert.True(t, results[100], name)
+
+		for _, present := range bloomfilter.TestMany(filter, items) {
+			assert.True(t, present, name)
+		}
+
+		filter.Clear()
+		bloomfilter.AddMany(filter, items[:50])
+		assert.Equal(t, []bool{true, false}, bloomfilter.TestMany(filter, [][]byte{items[0], items[99]}), name)
+	}
+}
@@ -35,6 +35,35 @@ func TestFilter(t *testing.T) {
 
 }
 
+func TestMemoryFilter(t *testing.T) {
+	var factory = bloomfilter.NewFactory(bloomfilter.Config{
+		Default: "default",
+		Filters: bloomfilter.Filters{
+			"default": contracts.Fields{
+				"driver": "memory",
+				"size":   1000,
+				"k":      0.01,
+			},
+		},
+	}, nil)
+
+	assert.Nil(t, factory.Start())
+	defer factory.Close()
+
+	var filter = factory.Filter("default")
+
+	for i := 0; i < 100; i++ {
+		assert.False(t, filter.TestOrAddString(fmt.Sprintf("goal%d", i)))
+	}
+	for i := 0; i < 100; i++ {
+		assert.True(t, filter.TestString(fmt.Sprintf("goal%d", i)))
+	}
+
+	filter.Clear()
+	assert.Equal(t, uint(0), filter.Count())
+	assert.False(t, filter.TestString("goal1"))
+}
+
 /**
 goos: darwin
 goarch: amd64
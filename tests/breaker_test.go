@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"github.com/goal-web/bloomfilter"
+	"github.com/goal-web/bloomfilter/drivers"
+	"github.com/goal-web/contracts"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRedisOnError(t *testing.T) {
+	var redis = newFakeRedis()
+	var factory = bloomfilter.NewFactory(bloomfilter.Config{
+		Filters: bloomfilter.Filters{
+			"allow":    contracts.Fields{"driver": "redis", "items": 1000, "fpr": 0.01, "key": "allow"},
+			"deny":     contracts.Fields{"driver": "redis", "items": 1000, "fpr": 0.01, "key": "deny", "on_error": "deny"},
+			"fallback": contracts.Fields{"driver": "redis", "items": 1000, "fpr": 0.01, "key": "fallback", "on_error": "fallback"},
+			"spread":   contracts.Fields{"driver": "redis", "items": 1000, "fpr": 0.01, "key": "spread", "on_error": "fallback", "segment_bits": 4096, "hash_tag": "spread"},
+		},
+	}, redis)
+	for _, name := range []string{"allow", "deny", "fallback", "spread"} {
+		factory.Filter(name).AddString("a")
+	}
+
+	redis.failure = errors.New("connection refused")
+	assert.False(t, factory.Filter("allow").TestString("a"), "allow answers not present")
+	assert.Equal(t, []bool{false, false}, bloomfilter.TestMany(factory.Filter("allow"), [][]byte{[]byte("a"), []byte("b")}))
+	assert.True(t, factory.Filter("deny").TestString("b"), "deny answers present")
+	assert.Equal(t, []bool{true, true}, bloomfilter.TestOrAddMany(factory.Filter("deny"), [][]byte{[]byte("a"), []byte("b")}))
+
+	// the fallback answers from the adds of the process, including the ones made during the outage.
+	for _, name := range []string{"fallback", "spread"} {
+		var filter = factory.Filter(name)
+		assert.True(t, filter.TestString("a"), name)
+		assert.False(t, filter.TestString("b"), name)
+		assert.False(t, filter.TestOrAddString("b"), name)
+		assert.True(t, filter.TestString("b"), name)
+		assert.Equal(t, []bool{true, false}, bloomfilter.TestOrAddMany(filter, [][]byte{[]byte("a"), []byte("c")}), name)
+		assert.Equal(t, []bool{true, true, false}, bloomfilter.TestMany(filter, [][]byte{[]byte("a"), []byte("c"), []byte("d")}), name)
+	}
+
+	// the callers of the context API still see the errors.
+	_, err := factory.Filter("fallback").(bloomfilter.ContextFilter).TestCtx(context.Background(), []byte("a"))
+	assert.NotNil(t, err)
+}
+
+func TestRedisBreaker(t *testing.T) {
+	var redis = newFakeRedis()
+	var filter = drivers.RedisDriver(redis)("breaker", contracts.Fields{
+		"items": 1000, "fpr": 0.01, "breaker_threshold": 2, "breaker_cooldown": "50ms",
+	}).(*drivers.Redis)
+	filter.AddString("a")
+
+	// after two failures redis is not called until the cooldown has passed.
+	redis.failure = errors.New("connection refused")
+	filter.TestString("a")
+	filter.TestString("a")
+	assert.True(t, filter.Breaker.Open())
+	var calls = redis.calls
+	_, err := filter.TestCtx(context.Background(), []byte("a"))
+	assert.True(t, errors.Is(err, drivers.CircuitOpenErr))
+	filter.AddString("b")
+	assert.Equal(t, calls, redis.calls)
+
+	// a failed probe opens it for another cooldown.
+	time.Sleep(60 * time.Millisecond)
+	filter.TestString("a")
+	assert.Equal(t, calls+1, redis.calls)
+	assert.True(t, filter.Breaker.Open())
+
+	// a successful probe closes it.
+	redis.failure = nil
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, filter.TestString("a"))
+	assert.False(t, filter.Breaker.Open())
+	present, err := filter.TestCtx(context.Background(), []byte("a"))
+	assert.True(t, present)
+	assert.Nil(t, err)
+
+	// canceled calls are not failures of redis.
+	var ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 3; i++ {
+		_, err = filter.TestCtx(ctx, []byte("a"))
+		assert.True(t, errors.Is(err, context.Canceled))
+	}
+	assert.False(t, filter.Breaker.Open())
+}
+
+func TestRedisOnErrorConfig(t *testing.T) {
+	for field, value := range map[string]interface{}{"on_error": "maybe", "breaker_threshold": -1, "breaker_cooldown": "0s", "fallback_items": 0, "fallback_fpr": 2} {
+		_, err := drivers.RedisDriverE(newFakeRedis())("redis", contracts.Fields{field: value})
+		var configErr *bloomfilter.ConfigError
+		assert.True(t, errors.As(err, &configErr), field)
+		assert.Equal(t, field, configErr.Field)
+	}
+	filter, err := drivers.RedisDriverE(newFakeRedis())("redis", contracts.Fields{"breaker_threshold": 0})
+	assert.Nil(t, err)
+	assert.Nil(t, filter.(*drivers.Redis).Breaker)
+}
+
+func TestRedisFallbackSize(t *testing.T) {
+	// the local filter is sized by its own fields, not by the bits of the redis filter.
+	var redis = newFakeRedis()
+	filter, err := drivers.RedisDriverE(redis)("redis", contracts.Fields{"items": 1000, "bits": 1 << 36, "hashes": 7, "on_error": "fallback"})
+	assert.Nil(t, err)
+	assert.Equal(t, uint(1000), filter.(*drivers.Redis).Fallback.Items)
+	redis.failure = errors.New("connection refused")
+	filter.AddString("a")
+	assert.True(t, filter.TestString("a"))
+
+	filter, _ = drivers.RedisDriverE(redis)("redis", contracts.Fields{"items": 1 << 30, "on_error": "fallback"})
+	assert.Equal(t, uint(1<<20), filter.(*drivers.Redis).Fallback.Items)
+	filter, _ = drivers.RedisDriverE(redis)("redis", contracts.Fields{"items": 1 << 30, "fallback_items": 500, "fallback_fpr": 0.1})
+	assert.Equal(t, drivers.Params{Items: 500, FPR: 0.1}, filter.(*drivers.Redis).Fallback)
+}
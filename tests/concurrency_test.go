@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/goal-web/bloomfilter"
+	"github.com/goal-web/contracts"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentFilters hammers the in-process drivers from many goroutines,
+// run it with -race to detect data races.
+func TestConcurrentFilters(t *testing.T) {
+	var dir = t.TempDir()
+	var factory = bloomfilter.NewFactory(bloomfilter.Config{
+		Filters: bloomfilter.Filters{
+			"memory":   contracts.Fields{"driver": "memory", "size": 10000, "k": 0.01},
+			"file":     contracts.Fields{"driver": "file", "Len": 10000, "K": 0.01, "filepath": filepath.Join(dir, "file")},
+			"counting": contracts.Fields{"driver": "counting", "storage": "file", "size": 10000, "k": 0.01, "filepath": filepath.Join(dir, "counting")},
+			"scalable": contracts.Fields{"driver": "scalable", "storage": "file", "size": 1000, "k": 0.01, "filepath": filepath.Join(dir, "scalable")},
+			"cuckoo":   contracts.Fields{"driver": "cuckoo", "storage": "file", "size": 10000, "k": 0.01, "filepath": filepath.Join(dir, "cuckoo")},
+		},
+	}, nil)
+	assert.Nil(t, factory.Start())
+
+	for _, name := range []string{"memory", "file", "counting", "scalable", "cuckoo"} {
+		var filter = factory.Filter(name)
+		var wg sync.WaitGroup
+		for worker := 0; worker < 8; worker++ {
+			wg.Add(1)
+			go func(worker int) {
+				defer wg.Done()
+				for i := 0; i < 500; i++ {
+					key := fmt.Sprintf("goal%d-%d", worker, i)
+					filter.AddString(key)
+					filter.TestOrAddString(key)
+					filter.TestString(key)
+					if i%100 == 0 {
+						filter.Save()
+						filter.Count()
+					}
+				}
+			}(worker)
+		}
+		wg.Wait()
+
+		for worker := 0; worker < 8; worker++ {
+			for i := 0; i < 500; i++ {
+				assert.True(t, filter.TestString(fmt.Sprintf("goal%d-%d", worker, i)), name)
+			}
+		}
+	}
+	factory.Close()
+}
+
+// TestConcurrentLoad reads the size of the filters while they are loaded, run it with -race.
+func TestConcurrentLoad(t *testing.T) {
+	var dir = t.TempDir()
+	var factory = bloomfilter.NewFactory(bloomfilter.Config{
+		Filters: bloomfilter.Filters{
+			"counting": contracts.Fields{"driver": "counting", "storage": "file", "size": 1000, "k": 0.01, "filepath": filepath.Join(dir, "counting")},
+			"cuckoo":   contracts.Fields{"driver": "cuckoo", "storage": "file", "size": 1000, "k": 0.01, "filepath": filepath.Join(dir, "cuckoo")},
+		},
+	}, nil)
+
+	for _, name := range []string{"counting", "cuckoo"} {
+		var filter = factory.Filter(name)
+		filter.AddString("goal")
+		assert.Nil(t, filter.(bloomfilter.PersistentFilter).SaveE(), name)
+		var size = filter.Size()
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				assert.Nil(t, filter.(bloomfilter.PersistentFilter).LoadE(), name)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				assert.Equal(t, size, filter.Size(), name)
+			}
+		}()
+		wg.Wait()
+	}
+}
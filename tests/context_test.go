@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"github.com/goal-web/bloomfilter"
+	"github.com/goal-web/bloomfilter/drivers"
+	"github.com/goal-web/contracts"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+var _ bloomfilter.ContextFilter = &drivers.RedisCounting{}
+
+func TestContextFilter(t *testing.T) {
+	var redis = newFakeRedis()
+	var factory = bloomfilter.NewFactory(bloomfilter.Config{
+		Filters: bloomfilter.Filters{
+			"redis":      contracts.Fields{"driver": "redis", "items": 1000, "fpr": 0.01},
+			"segments":   contracts.Fields{"driver": "redis", "items": 1000, "fpr": 0.01, "segment_bits": 4096, "hash_tag": "spread"},
+			"redisbloom": contracts.Fields{"driver": "redisbloom", "size": 1000, "k": 0.01},
+			"window":     contracts.Fields{"driver": "window", "storage": "redis", "items": 1000, "fpr": 0.01, "window": "1h"},
+		},
+	}, redis)
+	var outage = errors.New("connection refused")
+
+	for _, name := range []string{"redis", "segments", "redisbloom", "window"} {
+		var filter = factory.Filter(name).(bloomfilter.ContextFilter)
+		assert.Nil(t, filter.AddCtx(context.Background(), []byte("a")), name)
+		present, err := filter.TestCtx(context.Background(), []byte("a"))
+		assert.True(t, present, name)
+		assert.Nil(t, err, name)
+		present, err = filter.TestCtx(context.Background(), []byte("b"))
+		assert.False(t, present, name)
+		assert.Nil(t, err, name)
+
+		// an outage is an error instead of "not present".
+		redis.failure = outage
+		present, err = filter.TestCtx(context.Background(), []byte("a"))
+		assert.False(t, present, name)
+		assert.True(t, errors.Is(err, outage), name)
+		assert.True(t, errors.Is(filter.AddCtx(context.Background(), []byte("b")), outage), name)
+		redis.failure = nil
+
+		// a slow server does not hold the caller past its deadline.
+		redis.latency = time.Second
+		var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+		var start = time.Now()
+		_, err = filter.TestCtx(ctx, []byte("a"))
+		assert.True(t, errors.Is(err, context.DeadlineExceeded), name)
+		assert.Less(t, time.Since(start), 500*time.Millisecond, name)
+		assert.True(t, errors.Is(filter.AddCtx(ctx, []byte("c")), context.DeadlineExceeded), name)
+		cancel()
+		redis.latency = 0
+	}
+}
+
+func TestContextHelpers(t *testing.T) {
+	var filter = drivers.NewMemory("memory", 1000, 0.01)
+	assert.Nil(t, bloomfilter.AddCtx(context.Background(), filter, []byte("a")))
+	present, err := bloomfilter.TestCtx(context.Background(), filter, []byte("a"))
+	assert.True(t, present)
+	assert.Nil(t, err)
+
+	var ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	assert.True(t, errors.Is(bloomfilter.AddCtx(ctx, filter, []byte("b")), context.Canceled))
+	present, err = bloomfilter.TestCtx(ctx, filter, []byte("a"))
+	assert.False(t, present)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.False(t, filter.TestString("b"))
+}
@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/goal-web/bloomfilter"
+	"github.com/goal-web/contracts"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCountingFilter(t *testing.T) {
+	for _, counter := range []int{4, 8} {
+		var factory = bloomfilter.NewFactory(bloomfilter.Config{
+			Filters: bloomfilter.Filters{
+				"counting": contracts.Fields{
+					"driver":  "counting",
+					"size":    1000,
+					"k":       0.01,
+					"counter": counter,
+				},
+			},
+		}, nil)
+
+		var filter = factory.Filter("counting").(bloomfilter.RemovableFilter)
+
+		for i := 0; i < 100; i++ {
+			assert.False(t, filter.TestAndAddString(fmt.Sprintf("goal%d", i)))
+		}
+		filter.AddString("goal0")
+		filter.RemoveString("goal0")
+		assert.True(t, filter.TestString("goal0"))
+		filter.RemoveString("goal0")
+		assert.False(t, filter.TestString("goal0"))
+
+		for i := 1; i < 100; i++ {
+			filter.RemoveString(fmt.Sprintf("goal%d", i))
+		}
+		assert.Equal(t, uint(0), filter.Count())
+	}
+}
+
+func TestCountingFileFilter(t *testing.T) {
+	var config = bloomfilter.Config{
+		Filters: bloomfilter.Filters{
+			"counting": contracts.Fields{
+				"driver":   "counting",
+				"storage":  "file",
+				"size":     1000,
+				"k":        0.01,
+				"filepath": filepath.Join(t.TempDir(), "counting"),
+			},
+		},
+	}
+	var factory = bloomfilter.NewFactory(config, nil)
+	assert.Nil(t, factory.Start())
+	factory.Filter("counting").AddString("goal")
+	factory.Filter("counting").AddString("web")
+	factory.Close()
+
+	factory = bloomfilter.NewFactory(config, nil)
+	assert.Nil(t, factory.Start())
+	var filter = factory.Filter("counting").(bloomfilter.RemovableFilter)
+	assert.True(t, filter.TestString("goal"))
+	filter.RemoveString("goal")
+	assert.False(t, filter.TestString("goal"))
+	assert.True(t, filter.TestString("web"))
+}
+
+func TestCountingCorruptHeader(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "default")
+	var factory = bloomfilter.NewFactory(fileConfig("counting", path), nil)
+	assert.Nil(t, factory.Start())
+	factory.Filter("default").AddString("goal")
+	factory.Close()
+	saved, err := os.ReadFile(path)
+	assert.Nil(t, err)
+
+	// the payload starts after the magic number and the header: size, k and the counter width.
+	for _, corrupt := range []struct{ offset, value uint64 }{{0, 0}, {0, 1 << 61}, {0, 1 << 63}, {0, 100}, {8, 0}} {
+		data := append([]byte(nil), saved...)
+		binary.BigEndian.PutUint64(data[44+corrupt.offset:], corrupt.value)
+		assert.Nil(t, os.WriteFile(path, data, 0644))
+		factory = bloomfilter.NewFactory(fileConfig("counting", path), nil)
+		assert.True(t, errors.Is(factory.Start(), bloomfilter.CorruptFileErr), corrupt)
+	}
+}
@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/goal-web/bloomfilter"
+	"github.com/goal-web/bloomfilter/drivers"
+	"github.com/goal-web/contracts"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCuckooFilter(t *testing.T) {
+	var config = bloomfilter.Config{
+		Filters: bloomfilter.Filters{
+			"cuckoo": contracts.Fields{
+				"driver":   "cuckoo",
+				"storage":  "file",
+				"size":     1000,
+				"k":        0.001,
+				"filepath": filepath.Join(t.TempDir(), "cuckoo"),
+			},
+		},
+	}
+	var factory = bloomfilter.NewFactory(config, nil)
+	assert.Nil(t, factory.Start())
+
+	var filter = factory.Filter("cuckoo").(bloomfilter.RemovableFilter)
+	for i := 0; i < 1000; i++ {
+		filter.AddString(fmt.Sprintf("goal%d", i))
+	}
+	assert.Equal(t, uint(1000), filter.Count())
+	for i := 0; i < 1000; i++ {
+		assert.True(t, filter.TestString(fmt.Sprintf("goal%d", i)))
+	}
+
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if filter.TestString(fmt.Sprintf("web%d", i)) {
+			falsePositives++
+		}
+	}
+	assert.Less(t, falsePositives, 30)
+
+	for i := 0; i < 500; i++ {
+		filter.RemoveString(fmt.Sprintf("goal%d", i))
+	}
+	assert.Equal(t, uint(500), filter.Count())
+	factory.Close()
+
+	factory = bloomfilter.NewFactory(config, nil)
+	assert.Nil(t, factory.Start())
+	filter = factory.Filter("cuckoo").(bloomfilter.RemovableFilter)
+	assert.Equal(t, uint(500), filter.Count())
+	for i := 500; i < 1000; i++ {
+		assert.True(t, filter.TestString(fmt.Sprintf("goal%d", i)))
+	}
+}
+
+func TestCuckooRepeatedAdds(t *testing.T) {
+	var filter = drivers.NewCuckoo("cuckoo", 1000, 0.01)
+	for i := 0; i < 100; i++ {
+		filter.AddString("hot")
+		bloomfilter.AddMany(filter, [][]byte{[]byte("hot")})
+	}
+	assert.Equal(t, uint(8), filter.Count(), "the copies of an item are bounded by its two buckets")
+	filter.AddString("other")
+	assert.True(t, filter.TestString("other"))
+	assert.True(t, filter.TestString("hot"))
+
+	// an item added twice is present until it is removed twice.
+	filter.AddString("twice")
+	filter.AddString("twice")
+	filter.RemoveString("twice")
+	assert.True(t, filter.TestString("twice"))
+	filter.RemoveString("twice")
+	assert.False(t, filter.TestString("twice"))
+}
+
+func TestCuckooSharedFingerprint(t *testing.T) {
+	// a single bucket and 4 bits fingerprints: an item tested present in a filter holding a single item shares its fingerprint.
+	var filter = drivers.NewCuckoo("cuckoo", 1, 0.5)
+	filter.AddString("goal")
+	var other string
+	for i := 0; other == ""; i++ {
+		if filter.TestString(fmt.Sprintf("web%d", i)) {
+			other = fmt.Sprintf("web%d", i)
+		}
+	}
+	filter.AddString(other)
+	filter.RemoveString("goal")
+	assert.True(t, filter.TestString(other), "removing an item keeps the items sharing its fingerprint")
+	filter.RemoveString(other)
+	assert.False(t, filter.TestString("goal"))
+}
+
+func TestCuckooCorruptHeader(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "default")
+	var factory = bloomfilter.NewFactory(fileConfig("cuckoo", path), nil)
+	assert.Nil(t, factory.Start())
+	factory.Close()
+	saved, err := os.ReadFile(path)
+	assert.Nil(t, err)
+
+	// the payload starts after the magic number and the header: buckets, fingerprint, count, victim and victim index.
+	for _, corrupt := range []struct{ offset, value uint64 }{{0, 1 << 50}, {0, 1 << 63}, {8, 64}, {16, 1 << 40}, {32, 1 << 40}} {
+		data := append([]byte(nil), saved...)
+		binary.BigEndian.PutUint64(data[44+corrupt.offset:], corrupt.value)
+		assert.Nil(t, os.WriteFile(path, data, 0644))
+		factory = bloomfilter.NewFactory(fileConfig("cuckoo", path), nil)
+		assert.True(t, errors.Is(factory.Start(), bloomfilter.CorruptFileErr), corrupt)
+	}
+}
@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"errors"
+	"github.com/goal-web/bloomfilter"
+	"github.com/goal-web/bloomfilter/drivers"
+	"github.com/goal-web/contracts"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFilterErrors(t *testing.T) {
+	var factory = bloomfilter.NewFactory(bloomfilter.Config{
+		Filters: bloomfilter.Filters{
+			"default":  contracts.Fields{"driver": "memory"},
+			"unknown":  contracts.Fields{"driver": "unknown"},
+			"file":     contracts.Fields{"driver": "file"},
+			"counting": contracts.Fields{"driver": "counting", "counter": 5},
+			"panics":   contracts.Fields{"driver": "panics"},
+		},
+	}, nil)
+	factory.Extend("panics", func(name string, config contracts.Fields) contracts.BloomFilter {
+		panic("boom")
+	})
+	var filters = factory.(*bloomfilter.Factory)
+	var configErr *bloomfilter.ConfigError
+
+	_, err := filters.FilterE("missing")
+	assert.True(t, errors.Is(err, bloomfilter.FilterNotDefineErr))
+	assert.True(t, errors.As(err, &configErr))
+	assert.Equal(t, "missing", configErr.Filter)
+
+	_, err = filters.FilterE("unknown")
+	assert.True(t, errors.Is(err, bloomfilter.DriverNotDefineErr))
+	assert.True(t, errors.As(err, &configErr))
+	assert.Equal(t, "driver", configErr.Field)
+
+	_, err = filters.FilterE("file")
+	assert.True(t, errors.Is(err, drivers.MissingFieldErr))
+	assert.True(t, errors.As(err, &configErr))
+	assert.Equal(t, "file", configErr.Filter)
+	assert.Equal(t, "filepath", configErr.Field)
+
+	_, err = filters.FilterE("counting")
+	assert.True(t, errors.Is(err, drivers.InvalidCounterWidthErr))
+
+	_, err = filters.FilterE("panics")
+	assert.True(t, errors.As(err, &configErr))
+	assert.Equal(t, "panics", configErr.Filter)
+
+	// the misconfigured filters are reported, the others keep working.
+	assert.NotNil(t, factory.Start())
+	filter, err := filters.FilterE("default")
+	assert.Nil(t, err)
+	assert.False(t, filter.TestOrAddString("goal"))
+	assert.True(t, filter.TestString("goal"))
+	assert.Panics(t, func() { factory.Filter("missing") })
+	factory.Close()
+}
+
+// loadPanics is a filter whose driver panics on the file it loads.
+type loadPanics struct {
+	contracts.BloomFilter
+}
+
+func (this loadPanics) Load() {
+	panic("makeslice: len out of range")
+}
+
+func TestLoadPanic(t *testing.T) {
+	var factory = bloomfilter.NewFactory(bloomfilter.Config{
+		Filters: bloomfilter.Filters{
+			"default": contracts.Fields{"driver": "memory"},
+			"panics":  contracts.Fields{"driver": "panics", "filepath": "corrupt"},
+		},
+	}, nil)
+	factory.Extend("panics", func(name string, config contracts.Fields) contracts.BloomFilter {
+		return loadPanics{drivers.NewMemory(name, 1000, 0.01)}
+	})
+
+	var corrupt *drivers.CorruptFileError
+	err := factory.Start()
+	assert.True(t, errors.Is(err, bloomfilter.CorruptFileErr))
+	assert.True(t, errors.As(err, &corrupt))
+	assert.Equal(t, "corrupt", corrupt.Path)
+	factory.Filter("default").AddString("goal")
+	assert.True(t, factory.Filter("default").TestString("goal"))
+}
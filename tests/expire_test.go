@@ -0,0 +1,136 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"github.com/goal-web/bloomfilter"
+	"github.com/goal-web/bloomfilter/drivers"
+	"github.com/goal-web/contracts"
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedisExpire(t *testing.T) {
+	var redis = newFakeRedis()
+	var factory = bloomfilter.NewFactory(bloomfilter.Config{
+		Filters: bloomfilter.Filters{
+			"campaign": contracts.Fields{"driver": "redis", "items": 1000, "fpr": 0.01, "expire": "1h"},
+			"session":  contracts.Fields{"driver": "redis", "items": 1000, "fpr": 0.01, "ttl": 600, "sliding": true},
+			"batch":    contracts.Fields{"driver": "redis", "items": 1000, "fpr": 0.01, "expire": "1h", "segment_bits": 4096, "hash_tag": "same"},
+			"forever":  contracts.Fields{"driver": "redis", "items": 1000, "fpr": 0.01},
+		},
+	}, redis)
+
+	var campaign = factory.Filter("campaign").(bloomfilter.ExpiringFilter)
+	ttl, err := campaign.TTL()
+	assert.Nil(t, err)
+	assert.Less(t, ttl, time.Duration(0), "the key does not exist yet")
+
+	campaign.AddString("a")
+	ttl, _ = campaign.TTL()
+	assert.InDelta(t, time.Hour, ttl, float64(time.Second))
+
+	// the time to live is only set by the first write, unless it is sliding.
+	var soon = time.Now().Add(time.Minute)
+	redis.expirations["bloomfilter:campaign"] = soon
+	campaign.AddString("b")
+	assert.Equal(t, soon, redis.expirations["bloomfilter:campaign"])
+
+	var session = factory.Filter("session").(bloomfilter.ExpiringFilter)
+	session.AddString("a")
+	redis.expirations["bloomfilter:session"] = soon
+	assert.True(t, session.TestOrAddString("a"))
+	ttl, _ = session.TTL()
+	assert.InDelta(t, 10*time.Minute, ttl, float64(time.Second))
+
+	var at = time.UnixMilli(time.Now().Add(24 * time.Hour).UnixMilli())
+	assert.Nil(t, session.ExpireAt(at))
+	assert.Equal(t, at, redis.expirations["bloomfilter:session"])
+
+	bloomfilter.AddMany(factory.Filter("batch"), [][]byte{[]byte("a"), []byte("b"), []byte("c")})
+	for key := range redis.bits {
+		if key != "bloomfilter:campaign" && key != "bloomfilter:session" {
+			assert.InDelta(t, time.Hour, time.Until(redis.expirations[key]), float64(time.Second), key)
+		}
+	}
+
+	var forever = factory.Filter("forever").(bloomfilter.ExpiringFilter)
+	forever.AddString("a")
+	ttl, _ = forever.TTL()
+	assert.Less(t, ttl, time.Duration(0))
+
+	// BITOP replaces the key, the time to live is set again.
+	delete(redis.expirations, "bloomfilter:campaign")
+	assert.Nil(t, campaign.(bloomfilter.MergeableFilter).Union(forever))
+	ttl, _ = campaign.TTL()
+	assert.InDelta(t, time.Hour, ttl, float64(time.Second))
+}
+
+func TestRedisExpireConfig(t *testing.T) {
+	for field, config := range map[string]contracts.Fields{
+		"expire": {"expire": "1us"},
+		"ttl":    {"ttl": "an hour"},
+	} {
+		var configErr *bloomfilter.ConfigError
+		_, err := drivers.RedisDriverE(newFakeRedis())("default", config)
+		assert.True(t, errors.As(err, &configErr), field)
+		assert.Equal(t, field, configErr.Field)
+		assert.True(t, errors.Is(err, drivers.InvalidFieldErr))
+	}
+
+	filter, err := drivers.RedisDriverE(newFakeRedis())("default", contracts.Fields{"ttl": 90, "sliding": "true"})
+	assert.Nil(t, err)
+	assert.Equal(t, 90*time.Second, filter.(*drivers.Redis).Expire)
+	assert.True(t, filter.(*drivers.Redis).Sliding)
+}
+
+func TestRedisExpireSegments(t *testing.T) {
+	var redis = newFakeRedis()
+	var factory = bloomfilter.NewFactory(bloomfilter.Config{
+		Filters: bloomfilter.Filters{
+			"same":    contracts.Fields{"driver": "redis", "items": 1000, "fpr": 0.01, "expire": "1h", "segment_bits": 1024, "hash_tag": "same"},
+			"spread":  contracts.Fields{"driver": "redis", "items": 1000, "fpr": 0.01, "expire": "1h", "segment_bits": 1024, "hash_tag": "spread"},
+			"sliding": contracts.Fields{"driver": "redis", "items": 1000, "fpr": 0.01, "expire": "1h", "segment_bits": 1024, "hash_tag": "spread", "sliding": true},
+		},
+	}, redis)
+	// deadlines returns the distinct times the written segments of the filter expire at.
+	var deadlines = func(prefix string) map[time.Time]bool {
+		var times = map[time.Time]bool{}
+		for key := range redis.bits {
+			if strings.HasPrefix(key, prefix) {
+				times[redis.expirations[key]] = true
+			}
+		}
+		return times
+	}
+
+	for _, name := range []string{"same", "spread", "sliding"} {
+		var filter = factory.Filter(name)
+		var prefix = map[string]string{"same": "{bloomfilter:same}", "spread": "bloomfilter:spread:", "sliding": "bloomfilter:sliding:"}[name]
+		filter.AddString("a")
+		var first = deadlines(prefix)
+		assert.Len(t, first, 1, name)
+
+		// the segments created by the next writes expire with the first ones, the sliding ones are all refreshed.
+		time.Sleep(5 * time.Millisecond)
+		for i := 0; i < 100; i++ {
+			filter.AddString(fmt.Sprintf("goal%d", i))
+		}
+		bloomfilter.AddMany(filter, [][]byte{[]byte("b"), []byte("c")})
+		var later = deadlines(prefix)
+		assert.Len(t, later, 1, name)
+		assert.Equal(t, name != "sliding", reflect.DeepEqual(first, later), name)
+
+		var at = time.UnixMilli(time.Now().Add(24 * time.Hour).UnixMilli())
+		assert.Nil(t, filter.(bloomfilter.ExpiringFilter).ExpireAt(at))
+		assert.Equal(t, map[time.Time]bool{at: true}, deadlines(prefix), name)
+
+		// once every segment has the fixed deadline the writes do not set it again, the sliding ones refresh it.
+		var expireAts = redis.expireAts
+		filter.AddString("d")
+		assert.Equal(t, name == "sliding", redis.expireAts > expireAts, name)
+	}
+}
@@ -0,0 +1,307 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/goal-web/contracts"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeRedis is an in-process redis connection that understands the commands used by the drivers,
+// calling any other method panics.
+type fakeRedis struct {
+	contracts.RedisConnection
+
+	mutex  sync.Mutex
+	blooms map[string]*fakeBloom
+	// bitops records the BITOP commands, such as "OR dest key1 key2".
+	bitops []string
+	// deletes records the keys of the DEL commands, such as "key1 key2".
+	deletes []string
+	// bitcounts are the replies of BITCOUNT by key, keys without one count the bits set by the scripts.
+	bitcounts map[string]int64
+	// bits holds the bits set by the scripts of the bitmap drivers by key.
+	bits map[string]map[int64]bool
+	// expirations are the times keys expire at, set by PEXPIREAT, PEXPIRE and the scripts,
+	// expireAts counts the PEXPIREAT and PEXPIRE commands.
+	expirations map[string]time.Time
+	expireAts   int
+	// failure is returned by the commands taking a context, which wait latency first, calls counts them.
+	failure error
+	latency time.Duration
+	calls   int
+}
+
+type fakeBloom struct {
+	capacity int64
+	items    map[string]bool
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{
+		blooms:      map[string]*fakeBloom{},
+		bitcounts:   map[string]int64{},
+		bits:        map[string]map[int64]bool{},
+		expirations: map[string]time.Time{},
+	}
+}
+
+// Connection implements contracts.RedisFactory.
+func (redis *fakeRedis) Connection(name ...string) contracts.RedisConnection {
+	return redis
+}
+
+func (redis *fakeRedis) Del(keys ...string) (int64, error) {
+	redis.mutex.Lock()
+	defer redis.mutex.Unlock()
+	redis.deletes = append(redis.deletes, strings.Join(keys, " "))
+	deleted := int64(0)
+	for _, key := range keys {
+		if _, exists := redis.blooms[key]; exists {
+			delete(redis.blooms, key)
+			deleted++
+		}
+		if _, exists := redis.bits[key]; exists {
+			delete(redis.bits, key)
+			delete(redis.expirations, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (redis *fakeRedis) BitOpOr(destKey string, keys ...string) (int64, error) {
+	return redis.bitop("OR", destKey, keys)
+}
+
+func (redis *fakeRedis) BitOpAnd(destKey string, keys ...string) (int64, error) {
+	return redis.bitop("AND", destKey, keys)
+}
+
+func (redis *fakeRedis) BitCount(key string, count *contracts.BitCount) (int64, error) {
+	redis.mutex.Lock()
+	defer redis.mutex.Unlock()
+	if count, exists := redis.bitcounts[key]; exists {
+		return count, nil
+	}
+	return int64(len(redis.bits[key])), nil
+}
+
+func (redis *fakeRedis) PExpireAt(key string, tm time.Time) (bool, error) {
+	redis.mutex.Lock()
+	defer redis.mutex.Unlock()
+	redis.expireAts++
+	if _, exists := redis.bits[key]; !exists {
+		return false, nil
+	}
+	redis.expirations[key] = tm
+	return true, nil
+}
+
+func (redis *fakeRedis) PExpire(key string, expiration time.Duration) (bool, error) {
+	return redis.PExpireAt(key, time.Now().Add(expiration))
+}
+
+// PTTL returns -2 for missing keys and -1 for keys without expiry, as redis.
+func (redis *fakeRedis) PTTL(key string) (time.Duration, error) {
+	redis.mutex.Lock()
+	defer redis.mutex.Unlock()
+	if _, exists := redis.bits[key]; !exists {
+		return -2, nil
+	}
+	if at, exists := redis.expirations[key]; exists {
+		return time.Until(at), nil
+	}
+	return -1, nil
+}
+
+// wait waits latency, it returns the failure or the error of ctx.
+func (redis *fakeRedis) wait(ctx context.Context) error {
+	redis.mutex.Lock()
+	failure, latency := redis.failure, redis.latency
+	redis.calls++
+	redis.mutex.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(latency):
+		return failure
+	}
+}
+
+func (redis *fakeRedis) EvalShaWithContext(ctx context.Context, sha string, keys []string, args ...interface{}) (interface{}, error) {
+	if err := redis.wait(ctx); err != nil {
+		return nil, err
+	}
+	return redis.EvalSha(sha, keys, args...)
+}
+
+func (redis *fakeRedis) EvalWithContext(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	if err := redis.wait(ctx); err != nil {
+		return nil, err
+	}
+	return redis.Eval(script, keys, args...)
+}
+
+func (redis *fakeRedis) CommandWithContext(ctx context.Context, method string, args ...interface{}) (interface{}, error) {
+	if err := redis.wait(ctx); err != nil {
+		return nil, err
+	}
+	return redis.Command(method, args...)
+}
+
+func (redis *fakeRedis) PExpireAtWithContext(ctx context.Context, key string, tm time.Time) (bool, error) {
+	if err := redis.wait(ctx); err != nil {
+		return false, err
+	}
+	return redis.PExpireAt(key, tm)
+}
+
+// EvalSha always misses so that the drivers send the script with Eval.
+func (redis *fakeRedis) EvalSha(sha string, keys []string, args ...interface{}) (interface{}, error) {
+	return nil, errors.New("NOSCRIPT No matching script")
+}
+
+// Eval runs the scripts of the bitmap drivers, they are told apart by the commands they call:
+// single item scripts take (key index, offset) pairs, batch scripts take k first,
+// the scripts that set the time to live take the expiry with its mode last and the one that sets
+// the time the keys are deleted at takes it alone.
+func (redis *fakeRedis) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	redis.mutex.Lock()
+	defer redis.mutex.Unlock()
+	set := strings.Contains(script, "SETBIT")
+	if !set && strings.Contains(script, "PEXPIREAT") {
+		expired := int64(0)
+		for _, key := range keys {
+			if redis.bits[key] != nil {
+				redis.expirations[key] = time.UnixMilli(fakeInt(args[0]))
+				expired++
+			}
+		}
+		return expired, nil
+	}
+	if strings.Contains(script, "PEXPIRE") {
+		expire, mode := fakeInt(args[len(args)-2]), fakeInt(args[len(args)-1])
+		args = args[:len(args)-2]
+		defer func() {
+			deadline := time.Now().Add(time.Duration(expire) * time.Millisecond)
+			for _, key := range keys {
+				if at, exists := redis.expirations[key]; exists && mode == 0 {
+					deadline = at
+					break
+				}
+			}
+			if mode == 2 {
+				deadline = time.UnixMilli(expire)
+			}
+			for _, key := range keys {
+				if _, exists := redis.expirations[key]; expire > 0 && redis.bits[key] != nil && (mode == 1 || !exists) {
+					redis.expirations[key] = deadline
+				}
+			}
+		}()
+	}
+	if !strings.Contains(script, "local k") {
+		return redis.evalItem(set, keys, args), nil
+	}
+	k := 2 * int(fakeInt(args[0]))
+	results := make([]interface{}, 0, (len(args)-1)/k)
+	for i := 1; i < len(args); i += k {
+		results = append(results, redis.evalItem(set, keys, args[i:i+k]))
+	}
+	return results, nil
+}
+
+// evalItem tests or sets the bits of an item and returns 1 when all of them were set.
+func (redis *fakeRedis) evalItem(set bool, keys []string, args []interface{}) int64 {
+	present := int64(1)
+	for i := 0; i < len(args); i += 2 {
+		key, offset := keys[fakeInt(args[i])-1], fakeInt(args[i+1])
+		if !redis.bits[key][offset] {
+			present = 0
+			if !set {
+				break
+			}
+			if redis.bits[key] == nil {
+				redis.bits[key] = map[int64]bool{}
+			}
+			redis.bits[key][offset] = true
+		}
+	}
+	return present
+}
+
+func fakeInt(arg interface{}) int64 {
+	value, err := strconv.ParseInt(fmt.Sprint(arg), 10, 64)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+func (redis *fakeRedis) bitop(op, destKey string, keys []string) (int64, error) {
+	redis.mutex.Lock()
+	defer redis.mutex.Unlock()
+	redis.bitops = append(redis.bitops, strings.Join(append([]string{op, destKey}, keys...), " "))
+	return 0, nil
+}
+
+func (redis *fakeRedis) Command(method string, args ...interface{}) (interface{}, error) {
+	redis.mutex.Lock()
+	defer redis.mutex.Unlock()
+	key := args[0].(string)
+	bloom := redis.blooms[key]
+	switch method {
+	case "BF.RESERVE":
+		if bloom != nil {
+			return nil, errors.New("ERR item exists")
+		}
+		redis.blooms[key] = &fakeBloom{capacity: int64(args[2].(uint)), items: map[string]bool{}}
+		return "OK", nil
+	case "BF.INFO":
+		if bloom == nil {
+			return nil, errors.New("ERR not found")
+		}
+		return []interface{}{"Capacity", bloom.capacity, "Number of items inserted", int64(len(bloom.items))}, nil
+	case "BF.ADD", "BF.MADD":
+		if bloom == nil {
+			bloom = &fakeBloom{capacity: 100, items: map[string]bool{}}
+			redis.blooms[key] = bloom
+		}
+		replies := make([]interface{}, 0, len(args)-1)
+		for _, item := range args[1:] {
+			item := fmt.Sprintf("%s", item)
+			if bloom.items[item] {
+				replies = append(replies, int64(0))
+			} else {
+				bloom.items[item] = true
+				replies = append(replies, int64(1))
+			}
+		}
+		if method == "BF.ADD" {
+			return replies[0], nil
+		}
+		return replies, nil
+	case "BF.EXISTS", "BF.MEXISTS":
+		replies := make([]interface{}, 0, len(args)-1)
+		for _, item := range args[1:] {
+			if bloom != nil && bloom.items[fmt.Sprintf("%s", item)] {
+				replies = append(replies, int64(1))
+			} else {
+				replies = append(replies, int64(0))
+			}
+		}
+		if method == "BF.EXISTS" {
+			return replies[0], nil
+		}
+		return replies, nil
+	}
+	return nil, fmt.Errorf("ERR unknown command '%s'", method)
+}
@@ -0,0 +1,44 @@
+package tests
+
+import (
+	"errors"
+	"github.com/goal-web/bloomfilter"
+	"github.com/goal-web/contracts"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileSaveAndCorruptLoad(t *testing.T) {
+	var dir = t.TempDir()
+	var path = filepath.Join(dir, "default")
+	var config = bloomfilter.Config{
+		Filters: bloomfilter.Filters{
+			"default": contracts.Fields{"driver": "file", "Len": 1000, "K": 0.01, "filepath": path},
+		},
+	}
+
+	// a missing file is not an error.
+	var factory = bloomfilter.NewFactory(config, nil)
+	assert.Nil(t, factory.Start())
+	factory.Filter("default").AddString("goal")
+	assert.Nil(t, factory.Filter("default").(bloomfilter.PersistentFilter).SaveE())
+
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+
+	factory = bloomfilter.NewFactory(config, nil)
+	assert.Nil(t, factory.Start())
+	assert.True(t, factory.Filter("default").TestString("goal"))
+
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Nil(t, os.Truncate(path, info.Size()/2))
+
+	factory = bloomfilter.NewFactory(config, nil)
+	err = factory.Start()
+	assert.True(t, errors.Is(err, bloomfilter.CorruptFileErr))
+	assert.False(t, factory.Filter("default").TestString("goal"))
+}
@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/bits-and-blooms/bitset"
+	"github.com/goal-web/bloomfilter"
+	"github.com/goal-web/bloomfilter/drivers"
+	"github.com/goal-web/contracts"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func fileConfig(driver, path string) bloomfilter.Config {
+	return bloomfilter.Config{
+		Filters: bloomfilter.Filters{
+			"default": contracts.Fields{"driver": driver, "storage": "file", "Len": 1000, "K": 0.01, "filepath": path},
+		},
+	}
+}
+
+func TestFormatChecksum(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "default")
+	var factory = bloomfilter.NewFactory(fileConfig("file", path), nil)
+	assert.Nil(t, factory.Start())
+	factory.Filter("default").AddString("goal")
+	factory.Close()
+
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "GWBF", string(data[:4]))
+	data[len(data)/2] ^= 0xff
+	assert.Nil(t, os.WriteFile(path, data, 0644))
+
+	factory = bloomfilter.NewFactory(fileConfig("file", path), nil)
+	err = factory.Start()
+	assert.True(t, errors.Is(err, bloomfilter.CorruptFileErr))
+	assert.True(t, errors.Is(err, drivers.ChecksumMismatchErr))
+}
+
+func TestFormatFilterType(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "default")
+	var factory = bloomfilter.NewFactory(fileConfig("cuckoo", path), nil)
+	assert.Nil(t, factory.Start())
+	factory.Close()
+
+	factory = bloomfilter.NewFactory(fileConfig("file", path), nil)
+	assert.True(t, errors.Is(factory.Start(), drivers.UnsupportedFormatErr))
+}
+
+func TestFormatLegacy(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "default")
+	file, err := os.Create(path)
+	assert.Nil(t, err)
+	assert.Nil(t, binary.Write(file, binary.BigEndian, []uint64{128, 3}))
+	_, err = bitset.New(128).Complement().WriteTo(file)
+	assert.Nil(t, err)
+	assert.Nil(t, file.Close())
+
+	var factory = bloomfilter.NewFactory(fileConfig("file", path), nil)
+	assert.Nil(t, factory.Start())
+	assert.Equal(t, uint(128), factory.Filter("default").Size())
+	assert.True(t, factory.Filter("default").TestString("goal"))
+}
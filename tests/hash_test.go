@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"github.com/goal-web/bloomfilter"
+	"github.com/goal-web/bloomfilter/drivers"
+	"github.com/goal-web/bloomfilter/hash"
+	"github.com/goal-web/contracts"
+	"github.com/stretchr/testify/assert"
+	stdfnv "hash/fnv"
+	"path/filepath"
+	"testing"
+)
+
+func TestHashVectors(t *testing.T) {
+	assert.Equal(t, uint64(0xef46db3751d8e999), hash.Sum64XX(0, []byte("")))
+	assert.Equal(t, uint64(0xd24ec4f1a98c6e5b), hash.Sum64XX(0, []byte("a")))
+	assert.Equal(t, uint64(0x44bc2cf5ad770999), hash.Sum64XX(0, []byte("abc")))
+	assert.Equal(t, uint64(0xfbcea83c8a378bf1), hash.Sum64XX(0, []byte("Nobody inspects the spammish repetition")))
+
+	// the reference vectors of SipHash-2-4, key 00..0f.
+	var key, message [16]byte
+	for i := range key {
+		key[i], message[i] = byte(i), byte(i)
+	}
+	assert.Equal(t, uint64(0x726fdb47dd0e0e31), hash.Sum64Sip(0x0706050403020100, 0x0f0e0d0c0b0a0908, nil))
+	assert.Equal(t, uint64(0xa129ca6149be45e5), hash.Sum64Sip(0x0706050403020100, 0x0f0e0d0c0b0a0908, message[:15]))
+	sum, _, _, _ := hash.SipHash(key).Sum256(message[:15])
+	assert.Equal(t, uint64(0xa129ca6149be45e5), sum)
+
+	for _, data := range []string{"", "a", "goal-web/bloomfilter"} {
+		var fnv = stdfnv.New64a()
+		fnv.Write([]byte(data))
+		sum, _, _, _ := hash.FNV1a(0).Sum256([]byte(data))
+		assert.Equal(t, fnv.Sum64(), sum, data)
+	}
+
+	// murmur3 without seed is the hash function filters have always used.
+	var d hash.Digest128
+	h1, h2, h3, h4 := d.Sum256([]byte("goal"))
+	m1, m2, m3, m4 := hash.Murmur3(0).Sum256([]byte("goal"))
+	assert.Equal(t, []uint64{h1, h2, h3, h4}, []uint64{m1, m2, m3, m4})
+	s1, _, _, _ := hash.Murmur3(1).Sum256([]byte("goal"))
+	assert.NotEqual(t, h1, s1)
+}
+
+func TestHashers(t *testing.T) {
+	var dir = t.TempDir()
+	var filters = bloomfilter.Filters{
+		"murmur3":  contracts.Fields{"driver": "memory", "items": 1000, "fpr": 0.01, "hash": "murmur3", "seed": 42},
+		"xxhash64": contracts.Fields{"driver": "counting", "items": 1000, "fpr": 0.01, "hash": "xxhash64"},
+		"fnv1a":    contracts.Fields{"driver": "scalable", "items": 100, "fpr": 0.01, "hash": "fnv1a"},
+		"siphash":  contracts.Fields{"driver": "cuckoo", "items": 1000, "fpr": 0.01, "hash": "siphash", "hash_key": "000102030405060708090a0b0c0d0e0f"},
+		"file":     contracts.Fields{"driver": "file", "items": 1000, "fpr": 0.01, "hash": "siphash", "hash_key": "000102030405060708090a0b0c0d0e0f", "filepath": filepath.Join(dir, "file")},
+	}
+	var factory = bloomfilter.NewFactory(bloomfilter.Config{Filters: filters}, nil)
+	assert.Nil(t, factory.Start())
+	for name := range filters {
+		var filter = factory.Filter(name)
+		for i := 0; i < 1000; i++ {
+			filter.AddString(fmt.Sprintf("%s-%d", name, i))
+		}
+		for i := 0; i < 1000; i++ {
+			assert.True(t, filter.TestString(fmt.Sprintf("%s-%d", name, i)), name)
+		}
+		assert.InDelta(t, 1000, filter.(bloomfilter.StatsFilter).EstimatedItems(), 60, name)
+	}
+	factory.Close()
+
+	// the file can only be loaded with the same hash function and key.
+	filters["file"]["hash_key"] = "0f0e0d0c0b0a09080706050403020100"
+	factory = bloomfilter.NewFactory(bloomfilter.Config{Filters: filters}, nil)
+	err := factory.Start()
+	assert.True(t, errors.Is(err, drivers.HasherMismatchErr))
+	assert.False(t, errors.Is(err, bloomfilter.CorruptFileErr))
+
+	filters["file"] = contracts.Fields{"driver": "file", "items": 1000, "fpr": 0.01, "filepath": filepath.Join(dir, "file")}
+	factory = bloomfilter.NewFactory(bloomfilter.Config{Filters: filters}, nil)
+	assert.True(t, errors.Is(factory.Start(), drivers.HasherMismatchErr))
+
+	var merged = drivers.NewMemory("merged", 1000, 0.01)
+	assert.True(t, errors.Is(merged.Union(factory.Filter("murmur3")), drivers.IncompatibleFilterErr))
+}
+
+func TestHasherConfig(t *testing.T) {
+	for field, config := range map[string]contracts.Fields{
+		"hash":     {"driver": "memory", "hash": "md5"},
+		"hash_key": {"driver": "memory", "hash": "siphash"},
+	} {
+		var configErr *bloomfilter.ConfigError
+		_, err := drivers.MemoryDriverE("default", config)
+		assert.True(t, errors.As(err, &configErr), field)
+		assert.Equal(t, field, configErr.Field)
+	}
+
+	_, err := drivers.MemoryDriverE("default", contracts.Fields{"hash": "siphash", "hash_key": "0001"})
+	assert.True(t, errors.Is(err, hash.InvalidKeyErr))
+	_, err = drivers.MemoryDriverE("default", contracts.Fields{"hash": "md5"})
+	assert.True(t, errors.Is(err, hash.UnknownHashErr))
+	_, err = drivers.RedisBloomDriverE(newFakeRedis())("default", contracts.Fields{"hash": "xxhash64"})
+	assert.True(t, errors.Is(err, drivers.InvalidFieldErr))
+}
@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"github.com/goal-web/bloomfilter"
+	"github.com/goal-web/bloomfilter/drivers"
+	"github.com/goal-web/contracts"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+func TestMergeMemory(t *testing.T) {
+	var dir = t.TempDir()
+	var factory = bloomfilter.NewFactory(bloomfilter.Config{
+		Filters: bloomfilter.Filters{
+			"shard0": contracts.Fields{"driver": "memory", "items": 1000, "fpr": 0.01},
+			"shard1": contracts.Fields{"driver": "memory", "items": 1000, "fpr": 0.01},
+			"shard2": contracts.Fields{"driver": "file", "items": 1000, "fpr": 0.01, "filepath": filepath.Join(dir, "shard2")},
+			"small":  contracts.Fields{"driver": "memory", "items": 100, "fpr": 0.01},
+			"hashes": contracts.Fields{"driver": "memory", "items": 1000, "fpr": 0.01, "hashes": 3},
+		},
+	}, nil)
+	assert.Nil(t, factory.Start())
+
+	for i, name := range []string{"shard0", "shard1", "shard2"} {
+		for j := 0; j < 100; j++ {
+			factory.Filter(name).AddString(fmt.Sprintf("%d-%d", i, j))
+		}
+	}
+	factory.Filter("shard1").AddString("common")
+	factory.Filter("shard2").AddString("common")
+
+	var merged = drivers.NewMemory("merged", 1000, 0.01)
+	assert.Nil(t, merged.Merge(factory.Filter("shard0"), factory.Filter("shard1"), factory.Filter("shard2")))
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 100; j++ {
+			assert.True(t, merged.TestString(fmt.Sprintf("%d-%d", i, j)))
+		}
+	}
+
+	var shard1 = factory.Filter("shard1").(bloomfilter.MergeableFilter)
+	assert.Nil(t, shard1.Intersect(factory.Filter("shard2")))
+	assert.True(t, shard1.TestString("common"))
+	assert.False(t, shard1.TestString("1-1"))
+
+	var shard0 = factory.Filter("shard0").(bloomfilter.MergeableFilter)
+	assert.Nil(t, shard0.Union(shard0))
+	assert.True(t, errors.Is(shard0.Union(factory.Filter("small")), drivers.IncompatibleFilterErr))
+	assert.True(t, errors.Is(shard0.Union(factory.Filter("hashes")), drivers.IncompatibleFilterErr))
+	assert.True(t, errors.Is(shard0.Merge(factory.Filter("shard1"), drivers.NewCuckoo("cuckoo", 1000, 0.01)), drivers.IncompatibleFilterErr))
+	assert.False(t, shard0.TestString("common"), "nothing is merged when a filter is not compatible")
+}
+
+func TestMergeRedis(t *testing.T) {
+	var redis = newFakeRedis()
+	var factory = bloomfilter.NewFactory(bloomfilter.Config{
+		Filters: bloomfilter.Filters{
+			"shard0":   contracts.Fields{"driver": "redis", "items": 1000, "fpr": 0.01},
+			"shard1":   contracts.Fields{"driver": "redis", "items": 1000, "fpr": 0.01},
+			"segments": contracts.Fields{"driver": "redis", "items": 1000, "fpr": 0.01, "segment_bits": 4096, "hash_tag": "same"},
+			"shard2":   contracts.Fields{"driver": "redis", "items": 1000, "fpr": 0.01, "segment_bits": 4096, "hash_tag": "same", "key": "other"},
+			"memory":   contracts.Fields{"driver": "memory", "items": 1000, "fpr": 0.01},
+		},
+	}, redis)
+
+	var shard0 = factory.Filter("shard0").(bloomfilter.MergeableFilter)
+	assert.Nil(t, shard0.Union(factory.Filter("shard1")))
+	assert.Nil(t, factory.Filter("segments").(bloomfilter.MergeableFilter).Intersect(factory.Filter("shard2")))
+	assert.Equal(t, []string{
+		"OR bloomfilter:shard0 bloomfilter:shard0 bloomfilter:shard1",
+		"AND {bloomfilter:segments}:0 {bloomfilter:segments}:0 {other}:0",
+		"AND {bloomfilter:segments}:1 {bloomfilter:segments}:1 {other}:1",
+		"AND {bloomfilter:segments}:2 {bloomfilter:segments}:2 {other}:2",
+	}, redis.bitops)
+
+	assert.True(t, errors.Is(shard0.Union(factory.Filter("segments")), drivers.IncompatibleFilterErr))
+	assert.True(t, errors.Is(shard0.Union(factory.Filter("memory")), drivers.IncompatibleFilterErr))
+}
+
+func TestMergeWal(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "file")
+	var config = contracts.Fields{"filepath": path, "items": 1000, "fpr": 0.01, "wal": true}
+	filter, err := drivers.FileDriverE("file", config)
+	assert.Nil(t, err)
+	var written = make(chan struct{}, 1)
+	filter.(bloomfilter.DirtyFilter).NotifyWrites(1, written)
+
+	var other = drivers.NewMemory("memory", 1000, 0.01)
+	other.AddString("goal")
+	assert.Nil(t, filter.(*drivers.File).Merge(other))
+	assert.Len(t, written, 1, "a merge counts as a write")
+
+	// the log can not record a merge, the process stops without saving and the merge is in the file.
+	recovered, _ := drivers.FileDriverE("file", config)
+	assert.Nil(t, recovered.(bloomfilter.PersistentFilter).LoadE())
+	assert.True(t, recovered.TestString("goal"))
+	assert.Nil(t, filter.(io.Closer).Close())
+	assert.Nil(t, recovered.(io.Closer).Close())
+}
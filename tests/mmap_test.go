@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"github.com/goal-web/bloomfilter"
+	"github.com/goal-web/bloomfilter/drivers"
+	"github.com/goal-web/contracts"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMmapFilter(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "mmap")
+	var config = bloomfilter.Config{
+		Filters: bloomfilter.Filters{
+			"mmap": contracts.Fields{"driver": "mmap", "items": 1000, "fpr": 0.01, "filepath": path},
+		},
+	}
+	if _, err := drivers.MmapDriverE("mmap", config.Filters["mmap"]); errors.Is(err, drivers.MmapUnsupportedErr) {
+		t.Skip(err)
+	}
+
+	var factory = bloomfilter.NewFactory(config, nil)
+	assert.Nil(t, factory.Start())
+	var filter = factory.Filter("mmap")
+	for i := 0; i < 1000; i++ {
+		filter.AddString(fmt.Sprintf("goal%d", i))
+	}
+	assert.True(t, filter.TestOrAddString("goal1"))
+	var count = filter.Count()
+
+	// another filter mapping the file sees the bits without saving.
+	var sibling = drivers.NewMmap("sibling", path, 10, 0.5)
+	assert.True(t, sibling.TestString("goal999"))
+	assert.Equal(t, filter.Size(), sibling.Size(), "the file keeps its size")
+	assert.Nil(t, sibling.Close())
+	factory.Close()
+
+	// the bits follow the header page, numbered from the first byte whatever the byte order of the host.
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 4096+4*((int(filter.Size())+31)/32), len(data))
+	var ones = 0
+	for _, b := range data[4096:] {
+		ones += bits.OnesCount8(b)
+	}
+	assert.Equal(t, int(count), ones)
+
+	factory = bloomfilter.NewFactory(config, nil)
+	assert.Nil(t, factory.Start())
+	filter = factory.Filter("mmap")
+	for i := 0; i < 1000; i++ {
+		assert.True(t, filter.TestString(fmt.Sprintf("goal%d", i)))
+	}
+	assert.Equal(t, count, filter.Count())
+	assert.Equal(t, []bool{true, false}, bloomfilter.TestMany(filter, [][]byte{[]byte("goal0"), []byte("web0")}))
+	assert.InDelta(t, 1000, filter.(bloomfilter.StatsFilter).EstimatedItems(), 50)
+	filter.Clear()
+	assert.Equal(t, uint(0), filter.Count())
+	factory.Close()
+}
+
+func TestMmapCorruptFile(t *testing.T) {
+	var dir = t.TempDir()
+	if _, err := drivers.MmapDriverE("mmap", contracts.Fields{"filepath": filepath.Join(dir, "mmap")}); errors.Is(err, drivers.MmapUnsupportedErr) {
+		t.Skip(err)
+	}
+
+	// a file written by the file driver is not a mapped filter.
+	file, _ := drivers.FileDriverE("file", contracts.Fields{"filepath": filepath.Join(dir, "file")})
+	file.AddString("a")
+	assert.Nil(t, file.(bloomfilter.PersistentFilter).SaveE())
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "garbage"), []byte("not a filter"), 0644))
+	for _, name := range []string{"file", "garbage"} {
+		var filter = drivers.NewMmap(name, filepath.Join(dir, name), 1000, 0.01)
+		assert.True(t, errors.Is(filter.LoadE(), bloomfilter.CorruptFileErr), name)
+		assert.False(t, filter.TestOrAddString("a"), "a filter that can not be mapped is empty")
+	}
+
+	var config = contracts.Fields{"driver": "mmap", "items": 1000, "fpr": 0.01, "filepath": filepath.Join(dir, "mmap")}
+	filter, _ := drivers.MmapDriverE("mmap", config)
+	filter.AddString("a")
+	assert.Nil(t, filter.(bloomfilter.PersistentFilter).SaveE())
+	assert.Nil(t, filter.(io.Closer).Close())
+
+	config["hash"] = "xxhash64"
+	filter, _ = drivers.MmapDriverE("mmap", config)
+	err := filter.(bloomfilter.PersistentFilter).LoadE()
+	assert.True(t, errors.Is(err, drivers.HasherMismatchErr))
+	assert.False(t, errors.Is(err, bloomfilter.CorruptFileErr))
+}
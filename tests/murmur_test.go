@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"github.com/goal-web/bloomfilter/hash"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// murmurGolden are the hashes of the first n bytes of murmurInput, they were computed before the portable
+// code path existed and must be the same on every GOARCH and with the purego build tag, otherwise
+// files written on one platform would be read with other locations on another.
+var murmurGolden = []struct {
+	n      int
+	hashes [4]uint64
+}{
+	{0, [4]uint64{0x0000000000000000, 0x0000000000000000, 0x7ace5c908374fe16, 0x778867e4430e6785}},
+	{1, [4]uint64{0x726ac6dd306a3e59, 0x4e711127c5b5a8e4, 0xb73e42bb654cee53, 0x750aa06ed9cd1bac}},
+	{3, [4]uint64{0x6e3febcaf3b53dce, 0xe5bb83e375ffb688, 0x48e71b48caaa75c0, 0x6cd6c727704979eb}},
+	{7, [4]uint64{0xbecbbf54236ce3a1, 0x2b3ba492e39cef50, 0xbac5910ae680718b, 0x777b82724d32d022}},
+	{8, [4]uint64{0xa5ee2a9a9132d3bd, 0x259e7f3a617e003a, 0x480d93e21231ab14, 0xf4732c4d308c9f26}},
+	{15, [4]uint64{0xba6a4b5e80ade4f4, 0xe00e5a8ff7e8f26d, 0x3a4365bf1d80bc92, 0xd440df670fd9d41a}},
+	{16, [4]uint64{0xc4b099c52f8f4ea1, 0x7d670219d92afe48, 0x4b8b6aeb5629637a, 0x1f9480146c741690}},
+	{17, [4]uint64{0xd4ae4b39fe53b127, 0x6602453b6681dbe9, 0xb88e8a6bf3a2c19e, 0x5ca6064adf80405c}},
+	{31, [4]uint64{0x9d91fedff00436fb, 0x7ea851ba737ebfd0, 0x7bfd1df50b8a5abf, 0x198864644eb9b3be}},
+	{32, [4]uint64{0x65bdb8dd080643ff, 0xbec31b8aa5f3910a, 0xaae28abd6a539c60, 0x7e1b1c7e6b22a575}},
+	{33, [4]uint64{0xb16757d8c4f72f1a, 0x9171ee56072d60a6, 0xf96fad8be8f31170, 0x4b8c8c7582c70619}},
+	{47, [4]uint64{0x1ae5d525c6171259, 0x831e560033fb7f91, 0xed43518f5d60c3a2, 0xaa0e0864bf2d49c6}},
+	{64, [4]uint64{0xf50f13e7205dfca3, 0xa5cf4256c64ec87c, 0x8d5ecabe09fa9ef0, 0xa1408451c92f3157}},
+}
+
+func murmurInput() []byte {
+	data := make([]byte, 65)
+	for i := range data {
+		data[i] = byte(i*7 + 3)
+	}
+	return data
+}
+
+func TestMurmurGolden(t *testing.T) {
+	var data = murmurInput()
+	for _, golden := range murmurGolden {
+		var d hash.Digest128
+		h1, h2, h3, h4 := d.Sum256(data[:golden.n])
+		assert.Equal(t, golden.hashes, [4]uint64{h1, h2, h3, h4}, golden.n)
+
+		// the same bytes at an odd address.
+		unaligned := append([]byte{0}, data[:golden.n]...)[1:]
+		h1, h2, h3, h4 = d.Sum256(unaligned)
+		assert.Equal(t, golden.hashes, [4]uint64{h1, h2, h3, h4}, golden.n)
+	}
+
+	var d hash.Digest128
+	h1, h2, h3, h4 := d.Sum256Seed(42, data[:33])
+	assert.Equal(t, [4]uint64{0xc98cb43be860dca3, 0x9c7c2775069f2d6a, 0xa498fd22ac929b34, 0x073a0bebeca12011}, [4]uint64{h1, h2, h3, h4})
+
+	// the reference MurmurHash3_x64_128 of "hello".
+	var reference hash.Digest128
+	h1, h2 = reference.Sum128(false, 5, []byte("hello"))
+	assert.Equal(t, [2]uint64{0xcbd8a7b341bd9b02, 0x5b1e906a48ae1d19}, [2]uint64{h1, h2})
+}
@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"errors"
+	"github.com/goal-web/bloomfilter"
+	"github.com/goal-web/bloomfilter/drivers"
+	"github.com/goal-web/contracts"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestParams(t *testing.T) {
+	params, err := drivers.ParseParams("default", contracts.Fields{"items": 1000, "fpr": 0.01})
+	assert.Nil(t, err)
+	assert.Equal(t, drivers.Params{Items: 1000, FPR: 0.01}, params)
+	m, k := params.Estimate()
+	assert.Equal(t, uint(9586), m)
+	assert.Equal(t, uint(7), k)
+
+	// legacy keys are still read, the new ones win.
+	legacy, err := drivers.ParseParams("default", contracts.Fields{"size": 1000, "k": 0.01})
+	assert.Nil(t, err)
+	assert.Equal(t, params, legacy)
+	legacy, err = drivers.ParseParams("default", contracts.Fields{"Len": 1000, "K": 0.5, "fpr": 0.01})
+	assert.Nil(t, err)
+	assert.Equal(t, params, legacy)
+
+	params, err = drivers.ParseParams("default", contracts.Fields{"items": 1000, "bits": 2048, "hashes": 3})
+	assert.Nil(t, err)
+	m, k = params.Estimate()
+	assert.Equal(t, uint(2048), m)
+	assert.Equal(t, uint(3), k)
+
+	params, err = drivers.ParseParams("default", contracts.Fields{})
+	assert.Nil(t, err)
+	assert.Equal(t, drivers.Params{Items: drivers.DefaultItems, FPR: drivers.DefaultFPR}, params)
+}
+
+func TestParamsValidation(t *testing.T) {
+	for field, config := range map[string]contracts.Fields{
+		"items":  {"driver": "memory", "items": 0},
+		"fpr":    {"driver": "counting", "fpr": 1},
+		"bits":   {"driver": "redis", "bits": -1},
+		"hashes": {"driver": "cuckoo", "hashes": 4},
+		"ratio":  {"driver": "scalable", "ratio": 1.5},
+	} {
+		var factory = bloomfilter.NewFactory(bloomfilter.Config{
+			Filters: bloomfilter.Filters{"default": config},
+		}, nil)
+		var configErr *bloomfilter.ConfigError
+		err := factory.Start()
+		assert.True(t, errors.Is(err, drivers.InvalidFieldErr), field)
+		assert.True(t, errors.As(err, &configErr), field)
+		assert.Equal(t, field, configErr.Field)
+	}
+
+	var factory = bloomfilter.NewFactory(bloomfilter.Config{
+		Filters: bloomfilter.Filters{"default": {"driver": "memory", "fpr": 0}},
+	}, nil)
+	assert.True(t, errors.Is(factory.Start(), drivers.InvalidFieldErr))
+}
+
+// the file driver used to read only "Len" and "K", it is sized like every other driver now.
+func TestParamsFileDriver(t *testing.T) {
+	var factory = bloomfilter.NewFactory(bloomfilter.Config{
+		Filters: bloomfilter.Filters{
+			"default": {"driver": "file", "size": 1000, "k": 0.01, "filepath": filepath.Join(t.TempDir(), "default")},
+		},
+	}, nil)
+	assert.Nil(t, factory.Start())
+	assert.Equal(t, uint(9586), factory.Filter("default").Size())
+}
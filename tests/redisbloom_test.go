@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/goal-web/bloomfilter"
+	"github.com/goal-web/contracts"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestRedisBloomFilter(t *testing.T) {
+	var factory = bloomfilter.NewFactory(bloomfilter.Config{
+		Filters: bloomfilter.Filters{
+			"redisbloom": contracts.Fields{
+				"driver": "redisbloom",
+				"size":   1000,
+				"k":      0.01,
+			},
+		},
+	}, newFakeRedis())
+
+	assert.Nil(t, factory.Start())
+	defer factory.Close()
+
+	var filter = factory.Filter("redisbloom")
+	assert.Equal(t, uint(1000), filter.Size())
+
+	for i := 0; i < 100; i++ {
+		assert.False(t, filter.TestOrAddString(fmt.Sprintf("goal%d", i)))
+	}
+	assert.True(t, filter.TestAndAddString("goal1"))
+	assert.True(t, filter.TestString("goal99"))
+	assert.False(t, filter.TestString("web"))
+	assert.Equal(t, uint(100), filter.Count())
+
+	filter.Clear()
+	assert.False(t, filter.TestString("goal1"))
+	filter.AddString("goal1")
+	assert.Equal(t, uint(1000), filter.Size())
+}
+
+// longRedis answers the BF.M* commands with one reply more than their items.
+type longRedis struct {
+	*fakeRedis
+}
+
+func (redis longRedis) Connection(name ...string) contracts.RedisConnection {
+	return redis
+}
+
+func (redis longRedis) Command(method string, args ...interface{}) (interface{}, error) {
+	reply, err := redis.fakeRedis.Command(method, args...)
+	if replies, ok := reply.([]interface{}); ok && strings.HasPrefix(method, "BF.M") {
+		return append(replies, int64(1)), err
+	}
+	return reply, err
+}
+
+func TestRedisBloomLongReply(t *testing.T) {
+	var factory = bloomfilter.NewFactory(bloomfilter.Config{
+		Filters: bloomfilter.Filters{
+			"redisbloom": contracts.Fields{"driver": "redisbloom", "items": 1000, "fpr": 0.01},
+		},
+	}, longRedis{newFakeRedis()})
+	var filter = factory.Filter("redisbloom").(bloomfilter.BatchFilter)
+	var items = [][]byte{[]byte("goal"), []byte("web")}
+
+	assert.Equal(t, []bool{false, false}, filter.TestOrAddMany(items))
+	assert.Equal(t, []bool{false, false}, filter.TestMany(items))
+}
@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/goal-web/bloomfilter"
+	"github.com/goal-web/bloomfilter/drivers"
+	"github.com/goal-web/contracts"
+	"github.com/stretchr/testify/assert"
+	"hash/crc32"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScalableFilter(t *testing.T) {
+	var config = bloomfilter.Config{
+		Filters: bloomfilter.Filters{
+			"scalable": contracts.Fields{
+				"driver":   "scalable",
+				"storage":  "file",
+				"size":     100,
+				"k":        0.01,
+				"filepath": filepath.Join(t.TempDir(), "scalable"),
+			},
+		},
+	}
+	var factory = bloomfilter.NewFactory(config, nil)
+	assert.Nil(t, factory.Start())
+
+	var filter = factory.Filter("scalable")
+	var size = filter.Size()
+	for i := 0; i < 1000; i++ {
+		filter.AddString(fmt.Sprintf("goal%d", i))
+	}
+	assert.Greater(t, filter.Size(), size)
+
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if filter.TestString(fmt.Sprintf("web%d", i)) {
+			falsePositives++
+		}
+	}
+	assert.Less(t, falsePositives, 100)
+	factory.Close()
+
+	factory = bloomfilter.NewFactory(config, nil)
+	assert.Nil(t, factory.Start())
+	filter = factory.Filter("scalable")
+	for i := 0; i < 1000; i++ {
+		assert.True(t, filter.TestString(fmt.Sprintf("goal%d", i)))
+	}
+}
+
+func TestScalableCorruptHeader(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "default")
+	var factory = bloomfilter.NewFactory(fileConfig("scalable", path), nil)
+	assert.Nil(t, factory.Start())
+	factory.Close()
+	saved, err := os.ReadFile(path)
+	assert.Nil(t, err)
+
+	// the payload starts after the magic number and the header: capacity, p, growth, ratio and the number of filters.
+	for _, corrupt := range []struct{ offset, value uint64 }{
+		{0, 0}, {8, math.Float64bits(0)}, {8, math.Float64bits(1)}, {8, math.Float64bits(math.NaN())},
+		{16, 0}, {24, math.Float64bits(0)}, {24, math.Float64bits(1.5)}, {24, math.Float64bits(math.NaN())},
+	} {
+		data := append([]byte(nil), saved...)
+		binary.BigEndian.PutUint64(data[44+corrupt.offset:], corrupt.value)
+		binary.BigEndian.PutUint32(data[len(data)-4:], crc32.Checksum(data[:len(data)-4], crc32.MakeTable(crc32.Castagnoli)))
+		assert.Nil(t, os.WriteFile(path, data, 0644))
+		factory = bloomfilter.NewFactory(fileConfig("scalable", path), nil)
+		err := factory.Start()
+		assert.True(t, errors.Is(err, bloomfilter.CorruptFileErr), corrupt)
+		assert.False(t, errors.Is(err, drivers.ChecksumMismatchErr), corrupt)
+	}
+}
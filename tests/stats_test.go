@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/goal-web/bloomfilter"
+	"github.com/goal-web/contracts"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	var factory = bloomfilter.NewFactory(bloomfilter.Config{
+		Filters: bloomfilter.Filters{
+			"memory":     contracts.Fields{"driver": "memory", "items": 1000, "fpr": 0.01},
+			"file":       contracts.Fields{"driver": "file", "items": 1000, "fpr": 0.01, "filepath": filepath.Join(t.TempDir(), "file")},
+			"counting":   contracts.Fields{"driver": "counting", "items": 1000, "fpr": 0.01},
+			"scalable":   contracts.Fields{"driver": "scalable", "items": 1000, "fpr": 0.01},
+			"cuckoo":     contracts.Fields{"driver": "cuckoo", "items": 1000, "fpr": 0.01},
+			"redisbloom": contracts.Fields{"driver": "redisbloom", "items": 1000, "fpr": 0.01},
+		},
+	}, newFakeRedis())
+
+	for _, name := range []string{"memory", "file", "counting", "scalable", "cuckoo", "redisbloom"} {
+		var filter = factory.Filter(name).(bloomfilter.StatsFilter)
+		assert.Equal(t, uint(0), filter.EstimatedItems(), name)
+		assert.Equal(t, float64(0), filter.CurrentFPR(), name)
+
+		for i := 0; i < 1000; i++ {
+			filter.AddString(fmt.Sprintf("item-%d", i))
+		}
+		assert.InDelta(t, 1000, filter.EstimatedItems(), 50, name)
+		assert.InDelta(t, 0.01, filter.CurrentFPR(), 0.01, name)
+		assert.Equal(t, uint(1000), filter.Capacity(), name)
+		assert.Equal(t, 0.01, filter.TargetFPR(), name)
+	}
+
+	var scalable = factory.Filter("scalable").(bloomfilter.StatsFilter)
+	for i := 1000; i < 3000; i++ {
+		scalable.AddString(fmt.Sprintf("item-%d", i))
+	}
+	assert.InDelta(t, 3000, scalable.EstimatedItems(), 150)
+	assert.Equal(t, uint(3000), scalable.Capacity())
+	assert.Less(t, scalable.CurrentFPR(), 0.01)
+}
+
+func TestStatsRedis(t *testing.T) {
+	var redis = newFakeRedis()
+	var factory = bloomfilter.NewFactory(bloomfilter.Config{
+		Filters: bloomfilter.Filters{
+			"default": contracts.Fields{"driver": "redis", "items": 1000, "fpr": 0.01, "segment_bits": 4096},
+		},
+	}, redis)
+	var filter = factory.Filter("default").(bloomfilter.StatsFilter)
+	assert.Equal(t, uint(9586), filter.Size())
+
+	// about 950 items set half of the bits of a filter of 9586 bits and 7 hash functions.
+	redis.bitcounts["bloomfilter:default:0"] = 2000
+	redis.bitcounts["bloomfilter:default:1"] = 1793
+	redis.bitcounts["bloomfilter:default:2"] = 1000
+	assert.Equal(t, uint(4793), filter.Count())
+	assert.InDelta(t, 950, filter.EstimatedItems(), 2)
+	assert.InDelta(t, 0.0078, filter.CurrentFPR(), 0.0001)
+	assert.Equal(t, uint(1000), filter.Capacity())
+	assert.Equal(t, 0.01, filter.TargetFPR())
+}
+
+func TestRedisClearSegments(t *testing.T) {
+	var redis = newFakeRedis()
+	var factory = bloomfilter.NewFactory(bloomfilter.Config{
+		Filters: bloomfilter.Filters{
+			"default": contracts.Fields{"driver": "redis", "items": 1000, "fpr": 0.01, "segment_bits": 4096},
+			"same":    contracts.Fields{"driver": "redis", "items": 1000, "fpr": 0.01, "segment_bits": 4096, "hash_tag": "same"},
+		},
+	}, redis)
+	factory.Filter("default").AddString("a")
+	factory.Filter("default").Clear()
+	factory.Filter("same").Clear()
+
+	// the segments that may be in different cluster slots are deleted one at a time.
+	assert.Equal(t, []string{
+		"bloomfilter:default:0", "bloomfilter:default:1", "bloomfilter:default:2",
+		"{bloomfilter:same}:0 {bloomfilter:same}:1 {bloomfilter:same}:2",
+	}, redis.deletes)
+	assert.False(t, factory.Filter("default").TestString("a"))
+}
@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"errors"
+	"github.com/goal-web/bloomfilter"
+	"github.com/goal-web/contracts"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type userID int32
+
+type uuid [16]byte
+
+type compositeKey struct {
+	Tenant  string
+	ID      int64
+	Deleted bool
+	Tags    []byte
+	Region  [2]byte
+	cache   map[string]int
+	Ignored *int `bloom:"-"`
+}
+
+func TestTypedEncoders(t *testing.T) {
+	// integers of any width give the same 8 bytes.
+	assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 42}, bloomfilter.IntEncoder[userID]().Encode(42))
+	assert.Equal(t, bloomfilter.IntEncoder[int64]().Encode(-1), bloomfilter.IntEncoder[int8]().Encode(-1))
+	assert.Equal(t, "int64", bloomfilter.IntEncoder[uint]().Name())
+
+	var id = uuid{0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3, 0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00}
+	assert.Equal(t, id[:], bloomfilter.UUIDEncoder[uuid]().Encode(id))
+	assert.Equal(t, id[:], bloomfilter.UUIDStringEncoder[string]().Encode("123E4567-e89b-12d3-a456-426614174000"))
+	assert.Equal(t, []byte("not-a-uuid"), bloomfilter.UUIDStringEncoder[string]().Encode("not-a-uuid"))
+	assert.Equal(t, bloomfilter.UUIDEncoder[uuid]().Name(), bloomfilter.UUIDStringEncoder[string]().Name())
+
+	var encoder = bloomfilter.StructEncoder[compositeKey]()
+	assert.Equal(t, "struct", encoder.Name())
+	assert.Equal(t, []byte{
+		2, 'e', 'u',
+		0, 0, 0, 0, 0, 0, 0, 7,
+		1,
+		1, 9,
+		'f', 'r',
+	}, encoder.Encode(compositeKey{Tenant: "eu", ID: 7, Deleted: true, Tags: []byte{9}, Region: [2]byte{'f', 'r'}}))
+	// the length prefixes keep ("ab", "c") and ("a", "bc") apart.
+	type pair struct{ A, B string }
+	assert.NotEqual(t, bloomfilter.StructEncoder[pair]().Encode(pair{"ab", "c"}), bloomfilter.StructEncoder[pair]().Encode(pair{"a", "bc"}))
+	assert.Panics(t, func() {
+		bloomfilter.StructEncoder[struct{ Next *int }]()
+	})
+}
+
+func TestTypedFilter(t *testing.T) {
+	var factory = bloomfilter.NewFactory(bloomfilter.Config{
+		Filters: bloomfilter.Filters{
+			"users":  contracts.Fields{"driver": "memory", "items": 1000, "fpr": 0.01, "encoding": "int64"},
+			"orders": contracts.Fields{"driver": "counting", "items": 1000, "fpr": 0.01, "encoding": "struct"},
+		},
+	}, nil)
+
+	users, err := bloomfilter.TypedFilter(factory, "users", bloomfilter.IntEncoder[userID]())
+	assert.Nil(t, err)
+	assert.Equal(t, "int64", users.Encoding())
+	assert.False(t, users.TestOrAdd(1))
+	assert.True(t, users.Test(1))
+	assert.Equal(t, []bool{true, false, false}, users.TestOrAddMany([]userID{1, 2, 3}))
+	assert.False(t, users.Remove(1))
+
+	// another service sees the same keys through int64.
+	var shared = bloomfilter.NewTyped(users.Filter(), bloomfilter.IntEncoder[int64]())
+	assert.Equal(t, []bool{true, true, true, false}, shared.TestMany([]int64{1, 2, 3, 4}))
+
+	_, err = bloomfilter.TypedFilter(factory, "users", bloomfilter.StringEncoder[string]())
+	assert.True(t, errors.Is(err, bloomfilter.EncodingMismatchErr))
+
+	orders, err := bloomfilter.TypedFilter(factory, "orders", bloomfilter.StructEncoder[compositeKey]())
+	assert.Nil(t, err)
+	orders.AddMany([]compositeKey{{Tenant: "eu", ID: 1}, {Tenant: "us", ID: 1}})
+	assert.True(t, orders.Test(compositeKey{Tenant: "eu", ID: 1}))
+	assert.True(t, orders.Remove(compositeKey{Tenant: "eu", ID: 1}))
+	assert.False(t, orders.Test(compositeKey{Tenant: "eu", ID: 1}))
+	assert.True(t, orders.Test(compositeKey{Tenant: "us", ID: 1}))
+
+	var custom = bloomfilter.NewTyped[float64](users.Filter(), bloomfilter.EncoderFunc("float", func(key float64) []byte {
+		return bloomfilter.IntEncoder[int64]().Encode(int64(key))
+	}))
+	assert.True(t, custom.Test(2.0))
+
+	// any factory is accepted, the encoding is only checked against the config of a *Factory.
+	var wrapped = struct{ contracts.BloomFactory }{factory}
+	others, err := bloomfilter.TypedFilter(wrapped, "users", bloomfilter.IntEncoder[userID]())
+	assert.Nil(t, err)
+	assert.True(t, others.Test(2))
+}
@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"github.com/goal-web/bloomfilter"
+	"github.com/goal-web/bloomfilter/drivers"
+	"github.com/goal-web/contracts"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWalReplay(t *testing.T) {
+	for _, sync := range []interface{}{nil, "always", "never", "5ms"} {
+		var path = filepath.Join(t.TempDir(), "file")
+		var config = contracts.Fields{"filepath": path, "items": 1000, "fpr": 0.01, "wal": true, "wal_sync": sync}
+		filter, err := drivers.FileDriverE("file", config)
+		assert.Nil(t, err)
+		filter.AddString("a")
+		assert.Nil(t, filter.(bloomfilter.PersistentFilter).SaveE())
+		filter.AddString("b")
+		bloomfilter.AddMany(filter, [][]byte{[]byte("c"), []byte("d")})
+
+		// the process stops without saving, the adds since the last save are in the log.
+		recovered, _ := drivers.FileDriverE("file", config)
+		assert.Nil(t, recovered.(bloomfilter.PersistentFilter).LoadE(), sync)
+		assert.Equal(t, []bool{true, true, true, true, false}, bloomfilter.TestMany(recovered, [][]byte{
+			[]byte("a"), []byte("b"), []byte("c"), []byte("d"), []byte("e"),
+		}), sync)
+		assert.Equal(t, filter.Count(), recovered.Count())
+		assert.Nil(t, filter.(io.Closer).Close())
+		assert.Nil(t, recovered.(io.Closer).Close())
+	}
+}
+
+func TestWalCompaction(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "file")
+	var config = contracts.Fields{"filepath": path, "items": 1000, "fpr": 0.01, "wal": true}
+	filter, _ := drivers.FileDriverE("file", config)
+	for i := 0; i < 100; i++ {
+		filter.AddString(fmt.Sprintf("goal%d", i))
+	}
+	before, _ := os.Stat(path + ".wal")
+	assert.Nil(t, filter.(bloomfilter.PersistentFilter).SaveE())
+	_, err := os.Stat(path + ".wal.old")
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	// the log starts over with the adds after the save, the clear is replayed too.
+	filter.Clear()
+	filter.AddString("web")
+	after, _ := os.Stat(path + ".wal")
+	assert.Less(t, after.Size(), before.Size())
+	recovered, _ := drivers.FileDriverE("file", config)
+	assert.Nil(t, recovered.(bloomfilter.PersistentFilter).LoadE())
+	assert.False(t, recovered.TestString("goal0"))
+	assert.True(t, recovered.TestString("web"))
+
+	// a save that failed after the log was renamed leaves it, it is replayed before the current one.
+	assert.Nil(t, recovered.(io.Closer).Close())
+	assert.Nil(t, os.Rename(path+".wal", path+".wal.old"))
+	recovered.AddString("goal")
+	recovered, _ = drivers.FileDriverE("file", config)
+	assert.Nil(t, recovered.(bloomfilter.PersistentFilter).LoadE())
+	assert.Equal(t, []bool{false, true, true}, bloomfilter.TestMany(recovered, [][]byte{[]byte("goal0"), []byte("web"), []byte("goal")}))
+	assert.Nil(t, recovered.(bloomfilter.PersistentFilter).SaveE())
+	_, err = os.Stat(path + ".wal.old")
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+	assert.Nil(t, recovered.(io.Closer).Close())
+}
+
+func TestWalTornRecord(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "file")
+	var config = contracts.Fields{"filepath": path, "items": 1000, "fpr": 0.01, "wal": true, "wal_sync": "never"}
+	filter, _ := drivers.FileDriverE("file", config)
+	filter.AddString("a")
+	assert.Nil(t, filter.(io.Closer).Close())
+
+	// the process stopped in the middle of a record, the records after it are dropped.
+	log, _ := os.OpenFile(path+".wal", os.O_WRONLY|os.O_APPEND, 0644)
+	log.Write([]byte{1, 2, 3})
+	log.Close()
+	filter, _ = drivers.FileDriverE("file", config)
+	assert.Nil(t, filter.(bloomfilter.PersistentFilter).LoadE())
+	assert.True(t, filter.TestString("a"))
+	filter.AddString("b")
+	assert.Nil(t, filter.(io.Closer).Close())
+
+	filter, _ = drivers.FileDriverE("file", config)
+	assert.Nil(t, filter.(bloomfilter.PersistentFilter).LoadE())
+	assert.True(t, filter.TestString("a"))
+	assert.True(t, filter.TestString("b"))
+	assert.Nil(t, filter.(io.Closer).Close())
+
+	// a log written with another hash function is not replayed.
+	config["hash"] = "xxhash64"
+	filter, _ = drivers.FileDriverE("file", config)
+	assert.True(t, errors.Is(filter.(bloomfilter.PersistentFilter).LoadE(), drivers.HasherMismatchErr))
+
+	assert.Nil(t, os.WriteFile(path+".wal", []byte("not a log, not a log, not a log, not a log, not a log"), 0644))
+	filter, _ = drivers.FileDriverE("file", config)
+	assert.True(t, errors.Is(filter.(bloomfilter.PersistentFilter).LoadE(), bloomfilter.CorruptFileErr))
+}
+
+func TestWalGroupCommit(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "file")
+	var config = contracts.Fields{"filepath": path, "items": 10000, "fpr": 0.01, "wal": true}
+	filter, _ := drivers.FileDriverE("file", config)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				filter.AddString(fmt.Sprintf("goal%d-%d", g, i))
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	recovered, _ := drivers.FileDriverE("file", config)
+	assert.Nil(t, recovered.(bloomfilter.PersistentFilter).LoadE())
+	for g := 0; g < 8; g++ {
+		for i := 0; i < 100; i++ {
+			assert.True(t, recovered.TestString(fmt.Sprintf("goal%d-%d", g, i)))
+		}
+	}
+	assert.Nil(t, filter.(io.Closer).Close())
+}
+
+func TestWalConfig(t *testing.T) {
+	// a number is a number of milliseconds.
+	enabled, interval, err := drivers.ParseWal("file", contracts.Fields{"wal": true, "wal_sync": 5})
+	assert.Nil(t, err)
+	assert.True(t, enabled)
+	assert.Equal(t, 5*time.Millisecond, interval)
+	_, interval, _ = drivers.ParseWal("file", contracts.Fields{"wal": true, "wal_sync": "2s"})
+	assert.Equal(t, 2*time.Second, interval)
+
+	for _, sync := range []interface{}{"sometimes", "-1s", -5} {
+		_, err := drivers.FileDriverE("file", contracts.Fields{"filepath": "file", "wal": true, "wal_sync": sync})
+		var configErr *bloomfilter.ConfigError
+		assert.True(t, errors.As(err, &configErr), sync)
+		assert.Equal(t, "wal_sync", configErr.Field)
+	}
+}
@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"errors"
+	"github.com/goal-web/bloomfilter"
+	"github.com/goal-web/bloomfilter/drivers"
+	"github.com/goal-web/contracts"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// clock is a time that tests move forward.
+type clock struct {
+	now time.Time
+}
+
+func (clock *clock) Now() time.Time {
+	return clock.now
+}
+
+func TestWindowFilter(t *testing.T) {
+	var now = &clock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	var filter = drivers.NewWindow("window", 1000, 0.01, 4*time.Hour, 4)
+	filter.Now = now.Now
+
+	filter.AddString("a")
+	filter.AddString("b")
+	assert.True(t, filter.TestString("a"))
+	assert.False(t, filter.TestString("c"))
+
+	// an item is remembered for the whole window, and at most one slice more.
+	now.now = now.now.Add(4*time.Hour + 59*time.Minute)
+	assert.True(t, filter.TestString("a"))
+	assert.True(t, filter.TestOrAddString("b"), "b is added to the current generation again")
+	assert.Equal(t, 2*drivers.NewMemory("generation", 1000, 0.01/5).Size(), filter.Size())
+	now.now = now.now.Add(time.Minute)
+	assert.False(t, filter.TestString("a"))
+	assert.True(t, filter.TestString("b"))
+	assert.Equal(t, []bool{false, true}, filter.TestMany([][]byte{[]byte("a"), []byte("b")}))
+
+	now.now = now.now.Add(5 * time.Hour)
+	assert.False(t, filter.TestString("b"))
+	assert.Equal(t, uint(0), filter.Count())
+	assert.Equal(t, 1000, int(filter.Capacity()))
+	assert.Equal(t, 0.01, filter.TargetFPR())
+
+	for i := 0; i < 1000; i++ {
+		filter.AddString(string(rune(i)))
+		now.now = now.now.Add(time.Minute)
+	}
+	assert.Less(t, filter.CurrentFPR(), 0.01)
+}
+
+func TestWindowFile(t *testing.T) {
+	var now = &clock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	var config = contracts.Fields{
+		"driver":      "window",
+		"items":       1000,
+		"fpr":         0.01,
+		"window":      "4h",
+		"generations": 4,
+		"storage":     "file",
+		"filepath":    filepath.Join(t.TempDir(), "window"),
+	}
+	filter, err := drivers.WindowDriverE(nil)("window", config)
+	assert.Nil(t, err)
+	filter.(*drivers.WindowFile).Now = now.Now
+	filter.AddString("old")
+	now.now = now.now.Add(3 * time.Hour)
+	filter.AddString("new")
+	assert.Nil(t, filter.(bloomfilter.PersistentFilter).SaveE())
+
+	now.now = now.now.Add(2 * time.Hour)
+	filter, _ = drivers.WindowDriverE(nil)("window", config)
+	filter.(*drivers.WindowFile).Now = now.Now
+	assert.Nil(t, filter.(bloomfilter.PersistentFilter).LoadE())
+	assert.False(t, filter.TestString("old"), "the generation of old left the window while the file was saved")
+	assert.True(t, filter.TestString("new"))
+
+	// the generations are placed by their start time when the window changes.
+	config["window"], config["generations"] = 8*3600, 8
+	filter, _ = drivers.WindowDriverE(nil)("window", config)
+	filter.(*drivers.WindowFile).Now = now.Now
+	assert.Nil(t, filter.(bloomfilter.PersistentFilter).LoadE())
+	assert.True(t, filter.TestString("old"))
+	assert.True(t, filter.TestString("new"))
+}
+
+func TestWindowRedis(t *testing.T) {
+	var redis = newFakeRedis()
+	var now = &clock{now: time.Unix(0, 0).Add(1000 * time.Hour)}
+	filter, err := drivers.WindowDriverE(redis)("seen", contracts.Fields{
+		"items":       1000,
+		"fpr":         0.01,
+		"window":      "4h",
+		"generations": 4,
+		"storage":     "redis",
+	})
+	assert.Nil(t, err)
+	filter.(*drivers.RedisWindow).Now = now.Now
+
+	assert.False(t, filter.TestOrAddString("a"))
+	assert.True(t, filter.TestOrAddString("a"))
+	assert.Equal(t, time.Unix(0, 0).Add(1005*time.Hour), redis.expirations["bloomfilter:seen:1000"])
+
+	now.now = now.now.Add(4 * time.Hour)
+	filter.AddString("b")
+	assert.Equal(t, time.Unix(0, 0).Add(1009*time.Hour), redis.expirations["bloomfilter:seen:1004"])
+	assert.Zero(t, redis.expireAts, "the writes set the TTL of the generations with their bits")
+	assert.Equal(t, []bool{true, true, false}, filter.(bloomfilter.BatchFilter).TestMany([][]byte{[]byte("a"), []byte("b"), []byte("c")}))
+	assert.Equal(t, filter.Count(), uint(len(redis.bits["bloomfilter:seen:1000"])+len(redis.bits["bloomfilter:seen:1004"])))
+
+	now.now = now.now.Add(time.Hour)
+	assert.False(t, filter.TestString("a"))
+	assert.True(t, filter.TestString("b"))
+
+	filter.Clear()
+	assert.False(t, filter.TestString("b"))
+	assert.Equal(t, uint(0), filter.Count())
+	for _, keys := range redis.deletes {
+		assert.NotContains(t, keys, " ", "a DEL of the keys of several generations fails with CROSSSLOT")
+	}
+}
+
+func TestWindowConfig(t *testing.T) {
+	for field, config := range map[string]contracts.Fields{
+		"window":      {"items": 1000},
+		"generations": {"window": "1h", "generations": 0},
+		"hash_tag":    {"window": "1h", "storage": "redis", "hash_tag": "other"},
+		"storage":     {"window": "1h", "storage": "disk"},
+	} {
+		var configErr *bloomfilter.ConfigError
+		_, err := drivers.WindowDriverE(newFakeRedis())("window", config)
+		assert.True(t, errors.As(err, &configErr), field)
+		assert.Equal(t, field, configErr.Field)
+	}
+
+	_, err := drivers.WindowDriverE(nil)("window", contracts.Fields{"window": "a day"})
+	assert.True(t, errors.Is(err, drivers.InvalidFieldErr))
+	_, err = drivers.WindowDriverE(nil)("window", contracts.Fields{"window": "1h", "generations": 24})
+	assert.Nil(t, err)
+}
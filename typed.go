@@ -0,0 +1,105 @@
+package bloomfilter
+
+import (
+	"errors"
+	"fmt"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/supports/utils"
+)
+
+var EncodingMismatchErr = errors.New("encoding does not match the config")
+
+// Typed is a filter of keys of type T, every key is converted to bytes by the encoder.
+type Typed[T any] struct {
+	filter  contracts.BloomFilter
+	encoder Encoder[T]
+}
+
+// NewTyped wraps filter so that keys of type T are encoded by encoder.
+func NewTyped[T any](filter contracts.BloomFilter, encoder Encoder[T]) *Typed[T] {
+	return &Typed[T]{filter: filter, encoder: encoder}
+}
+
+// TypedFilter returns the filter by name wrapped by NewTyped, it returns a *ConfigError wrapping
+// EncodingMismatchErr when the "encoding" field of the config is set and is not the name of encoder.
+// The errors of FilterE and the encoding are only checked when factory is a *Factory.
+func TypedFilter[T any](factory contracts.BloomFactory, name string, encoder Encoder[T]) (*Typed[T], error) {
+	bloomFactory, ok := factory.(*Factory)
+	if !ok {
+		return NewTyped(factory.Filter(name), encoder), nil
+	}
+	filter, err := bloomFactory.FilterE(name)
+	if err != nil {
+		return nil, err
+	}
+	if encoding := utils.GetStringField(bloomFactory.config.Filters[name], "encoding"); encoding != "" && encoding != encoder.Name() {
+		return nil, &ConfigError{
+			Filter: name,
+			Field:  "encoding",
+			Err:    fmt.Errorf("%w: %s, encoder is %s", EncodingMismatchErr, encoding, encoder.Name()),
+		}
+	}
+	return NewTyped(filter, encoder), nil
+}
+
+// Filter returns the wrapped filter.
+func (this *Typed[T]) Filter() contracts.BloomFilter {
+	return this.filter
+}
+
+// Encoding returns the name of the encoder.
+func (this *Typed[T]) Encoding() string {
+	return this.encoder.Name()
+}
+
+func (this *Typed[T]) Add(key T) {
+	this.filter.Add(this.encoder.Encode(key))
+}
+
+func (this *Typed[T]) Test(key T) bool {
+	return this.filter.Test(this.encoder.Encode(key))
+}
+
+// TestAndAdd is the equivalent to calling Test(key) then Add(key).
+// Returns the result of Test.
+func (this *Typed[T]) TestAndAdd(key T) bool {
+	return this.filter.TestAndAdd(this.encoder.Encode(key))
+}
+
+// TestOrAdd is the equivalent to calling Test(key) then if not present Add(key).
+// Returns the result of Test.
+func (this *Typed[T]) TestOrAdd(key T) bool {
+	return this.filter.TestOrAdd(this.encoder.Encode(key))
+}
+
+// Remove removes the key when the filter implements RemovableFilter, it returns whether it does.
+func (this *Typed[T]) Remove(key T) bool {
+	removable, ok := this.filter.(RemovableFilter)
+	if ok {
+		removable.Remove(this.encoder.Encode(key))
+	}
+	return ok
+}
+
+// AddMany adds all the keys, see AddMany.
+func (this *Typed[T]) AddMany(keys []T) {
+	AddMany(this.filter, this.encodeMany(keys))
+}
+
+// TestMany tests all the keys, see TestMany.
+func (this *Typed[T]) TestMany(keys []T) []bool {
+	return TestMany(this.filter, this.encodeMany(keys))
+}
+
+// TestOrAddMany calls TestOrAdd for all the keys, see TestOrAddMany.
+func (this *Typed[T]) TestOrAddMany(keys []T) []bool {
+	return TestOrAddMany(this.filter, this.encodeMany(keys))
+}
+
+func (this *Typed[T]) encodeMany(keys []T) [][]byte {
+	items := make([][]byte, len(keys))
+	for i, key := range keys {
+		items[i] = this.encoder.Encode(key)
+	}
+	return items
+}